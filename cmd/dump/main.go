@@ -6,7 +6,9 @@ import (
 	"sort"
 	"time"
 
+	"github.com/inv2004/goupbot/internal/upbot/config"
 	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
 	"github.com/recoilme/pudge"
 )
 
@@ -36,7 +38,7 @@ func dumpUsers() {
 		v.Feeds = v.Feeds[0:0]
 		fmt.Printf("  \"%s\" %v\n", k, v)
 		for i, f := range feeds {
-			fmt.Printf("    %d) %v\n", i+1, f)
+			fmt.Printf("    %d) %s\n", i+1, secret.Redact(fmt.Sprintf("%v", f)))
 		}
 	}
 }
@@ -72,6 +74,9 @@ func dumpJobs() {
 }
 
 func main() {
+	if err := config.Err(); err != nil {
+		log.Panic(err)
+	}
 	dumpUsers()
 	dumpJobs()
 }
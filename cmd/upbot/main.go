@@ -6,9 +6,13 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	_ "time/tzdata" // timezones for /stats on hosts without zoneinfo
 
 	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/config"
 	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/notify"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
 	"github.com/inv2004/goupbot/internal/upbot/telegram"
 	"github.com/inv2004/goupbot/internal/upbot/upwork"
 	"github.com/recoilme/pudge"
@@ -22,10 +26,15 @@ func main() {
 	logrus.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
 	})
+	logrus.AddHook(secret.Hook{})
+	if err := config.Err(); err != nil {
+		logrus.Panic(err)
+	}
 
 	if len(os.Args) == 2 && os.Args[1] == "migrate" {
 		// telegram.MigrateUserId()
 		// telegram.MigrateOneUser()
+		telegram.EncryptUrls()
 		telegram.Cleanup()
 		return
 	}
@@ -33,10 +42,13 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	bt := &bot.BotStruct{
-		Wg:     &sync.WaitGroup{},
-		Ctx:    ctx,
-		Up2tel: make(chan model.JobInfo),
-		Admin:  make(chan string),
+		Wg:      &sync.WaitGroup{},
+		Ctx:     ctx,
+		Cancel:  cancel,
+		Up2tel:  make(chan model.JobInfo, bot.Up2telQueueLen),
+		Admin:   make(chan bot.Alert, bot.AdminQueueLen),
+		Notice:  make(chan bot.Notice, bot.NoticeQueueLen),
+		Metrics: &bot.Metrics{},
 	}
 
 	defer func() {
@@ -47,15 +59,20 @@ func main() {
 		logrus.Info("db closed")
 	}()
 
-	bt.Wg.Add(2)
+	bt.Wg.Add(3)
 	go telegram.Start(bt)
 	go upwork.Start(bt)
+	go notify.RunDigest(bt)
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
-	<-quit
-	logrus.Warn("signal to shutdown ...")
+	select {
+	case <-quit:
+		logrus.Warn("signal to shutdown ...")
+	case <-ctx.Done():
+		logrus.Error("bot is stopped by error")
+	}
 	cancel()
 	bt.Wg.Wait()
 }
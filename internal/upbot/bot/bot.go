@@ -3,13 +3,45 @@ package bot
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/inv2004/goupbot/internal/upbot/model"
 )
 
+const (
+	Up2telQueueLen = 100
+	AdminQueueLen  = 10
+	NoticeQueueLen = 10
+)
+
+// Alert is feed error for the admin, aggregated before sending
+type Alert struct {
+	User string
+	Feed string
+	Err  string
+}
+
+// Notice is html message to the user from background jobs
+type Notice struct {
+	User string
+	Text string
+}
+
 type BotStruct struct {
-	Wg     *sync.WaitGroup
-	Ctx    context.Context
-	Up2tel chan model.JobInfo
-	Admin  chan string
+	Wg      *sync.WaitGroup
+	Ctx     context.Context
+	Cancel  context.CancelFunc // stops the bot on fatal errors of background goroutines
+	Up2tel  chan model.JobInfo
+	Admin   chan Alert
+	Notice  chan Notice
+	Metrics *Metrics
+}
+
+// Metrics are counters of processed commands and jobs, queue lengths are read from channels
+type Metrics struct {
+	Commands  atomic.Int64
+	Delivered atomic.Int64
+	Retried   atomic.Int64
+	Failed    atomic.Int64
+	Skipped   atomic.Int64
 }
@@ -2,8 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -11,38 +14,162 @@ type Config struct {
 	Telegram struct {
 		Token string
 		Admin string
+		// ApiUrl replaces https://api.telegram.org, e.g. for local fake server
+		ApiUrl  string
+		Webhook Webhook
 	}
 	Feed struct {
 		Delay time.Duration
 	}
+	Storage struct {
+		Key string
+	}
+	Format struct {
+		Layout string
+	}
+	Access Access
+	Smtp   struct {
+		Host     string
+		Port     int
+		User     string
+		Password string
+		From     string
+		StartTLS bool
+		// TLS is implicit tls from the start of connection, default for port 465
+		TLS bool
+		// Digest is interval of digest emails in minutes
+		Digest time.Duration
+	}
+}
+
+// Access limits who can use the bot, zero limits are unlimited
+type Access struct {
+	// Mode is open, allowlist or invite, open if empty
+	Mode     string
+	Allow    []string
+	MaxUsers int
+	MaxFeeds int
+	// MinPull is minimal pull interval in seconds
+	MinPull time.Duration
 }
 
 const (
-	ConfigFile = "config.json"
+	AccessOpen      = "open"
+	AccessAllowlist = "allowlist"
+	AccessInvite    = "invite"
 )
 
-var config Config
+// Webhook enables webhook mode instead of long polling if Url is set.
+// Without Cert and Key the server is plain http behind a reverse proxy
+type Webhook struct {
+	Url    string
+	Listen string
+	Path   string
+	Secret string
+	Cert   string
+	Key    string
+}
 
-func GetConfig() Config {
+const (
+	ConfigFile    = "config.json"
+	StorageKeyEnv = "UPBOT_STORAGE_KEY"
+)
+
+var (
+	mu      sync.RWMutex
+	config  Config
+	loadErr error
+)
+
+func get() Config {
+	mu.RLock()
+	defer mu.RUnlock()
 	return config
 }
 
+func GetConfig() Config {
+	return get()
+}
+
 func GetDelay() time.Duration {
-	return config.Feed.Delay * time.Second
+	return get().Feed.Delay * time.Second
 }
 
 func GetAdmin() string {
-	return config.Telegram.Admin
+	return get().Telegram.Admin
 }
 
-func init() {
+func GetDigestInterval() time.Duration {
+	cfg := get()
+	if cfg.Smtp.Digest == 0 {
+		return 24 * time.Hour
+	}
+	return cfg.Smtp.Digest * time.Minute
+}
+
+func GetAccess() Access {
+	return get().Access
+}
+
+func GetMinPull() time.Duration {
+	return get().Access.MinPull * time.Second
+}
+
+func GetLayout() string {
+	return get().Format.Layout
+}
+
+// GetStorageKey returns key to encrypt feed urls at rest, env overrides config
+func GetStorageKey() string {
+	if key := os.Getenv(StorageKeyEnv); key != "" {
+		return key
+	}
+	return get().Storage.Key
+}
+
+func load() (Config, error) {
+	cfg := Config{}
 	str, err := os.ReadFile(ConfigFile)
 	if err != nil {
-		log.Panic(err)
+		return cfg, err
 	}
-	config = Config{}
-	err = json.Unmarshal(str, &config)
+	err = json.Unmarshal(str, &cfg)
+	return cfg, err
+}
+
+// Reload reads config file again, telegram token and webhook are applied after restart only
+func Reload() error {
+	cfg, err := load()
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+	return nil
+}
+
+// Set replaces the config, e.g. in tests
+func Set(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+}
+
+// Err returns the error of reading config file at start
+func Err() error {
+	return loadErr
+}
+
+// init does not fail without config file so packages can be tested, commands check Err
+func init() {
+	cfg, err := load()
 	if err != nil {
-		log.Panic(err)
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Panic(err)
+		}
+		loadErr = err
+		return
 	}
+	config = cfg
 }
@@ -0,0 +1,85 @@
+package format
+
+import "strings"
+
+var countryCodes = map[string]string{
+	"Argentina":            "AR",
+	"Australia":            "AU",
+	"Austria":              "AT",
+	"Bangladesh":           "BD",
+	"Belgium":              "BE",
+	"Brazil":               "BR",
+	"Bulgaria":             "BG",
+	"Canada":               "CA",
+	"Chile":                "CL",
+	"China":                "CN",
+	"Colombia":             "CO",
+	"Croatia":              "HR",
+	"Cyprus":               "CY",
+	"Czech Republic":       "CZ",
+	"Denmark":              "DK",
+	"Egypt":                "EG",
+	"Estonia":              "EE",
+	"Finland":              "FI",
+	"France":               "FR",
+	"Georgia":              "GE",
+	"Germany":              "DE",
+	"Greece":               "GR",
+	"Hong Kong":            "HK",
+	"Hungary":              "HU",
+	"India":                "IN",
+	"Indonesia":            "ID",
+	"Ireland":              "IE",
+	"Israel":               "IL",
+	"Italy":                "IT",
+	"Japan":                "JP",
+	"Kazakhstan":           "KZ",
+	"Kenya":                "KE",
+	"Latvia":               "LV",
+	"Lithuania":            "LT",
+	"Luxembourg":           "LU",
+	"Malaysia":             "MY",
+	"Malta":                "MT",
+	"Mexico":               "MX",
+	"Netherlands":          "NL",
+	"New Zealand":          "NZ",
+	"Nigeria":              "NG",
+	"Norway":               "NO",
+	"Pakistan":             "PK",
+	"Philippines":          "PH",
+	"Poland":               "PL",
+	"Portugal":             "PT",
+	"Qatar":                "QA",
+	"Romania":              "RO",
+	"Saudi Arabia":         "SA",
+	"Serbia":               "RS",
+	"Singapore":            "SG",
+	"Slovakia":             "SK",
+	"Slovenia":             "SI",
+	"South Africa":         "ZA",
+	"South Korea":          "KR",
+	"Spain":                "ES",
+	"Sweden":               "SE",
+	"Switzerland":          "CH",
+	"Taiwan":               "TW",
+	"Thailand":             "TH",
+	"Turkey":               "TR",
+	"Ukraine":              "UA",
+	"United Arab Emirates": "AE",
+	"United Kingdom":       "GB",
+	"United States":        "US",
+	"Vietnam":              "VN",
+}
+
+// Flag returns emoji flag of the country, or globe if country is unknown
+func Flag(country string) string {
+	code, ok := countryCodes[strings.TrimSpace(country)]
+	if !ok {
+		return "🌍"
+	}
+	result := ""
+	for _, c := range code {
+		result += string(rune(0x1F1E6 + c - 'A'))
+	}
+	return result
+}
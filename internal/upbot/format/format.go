@@ -0,0 +1,110 @@
+package format
+
+import (
+	"bytes"
+	"embed"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+)
+
+const (
+	LayoutCompact = "compact"
+	LayoutFull    = "full"
+	LayoutMinimal = "minimal"
+
+	DefaultLayout = LayoutCompact
+)
+
+var Layouts = []string{LayoutCompact, LayoutFull, LayoutMinimal}
+
+//go:embed templates/*.tmpl
+var templatesFS embed.FS
+
+var templates = template.Must(template.New("job").Funcs(template.FuncMap{
+	"esc":      EscapeAttr,
+	"html":     Html,
+	"text":     Text,
+	"shorten":  Shorten,
+	"flag":     Flag,
+	"hashtags": Hashtags,
+	"rate":     Rate,
+}).ParseFS(templatesFS, "templates/*.tmpl"))
+
+func IsLayout(layout string) bool {
+	for _, v := range Layouts {
+		if v == layout {
+			return true
+		}
+	}
+	return false
+}
+
+// Render renders job into telegram html by the layout, default layout is used for unknown one
+func Render(layout string, job model.Job) (string, error) {
+	if !IsLayout(layout) {
+		layout = DefaultLayout
+	}
+
+	buf := bytes.Buffer{}
+	err := templates.ExecuteTemplate(&buf, layout+".tmpl", job)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Shorten cuts text to n runes by word boundary
+func Shorten(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	cut := string(runes[:n])
+	if idx := strings.LastIndexAny(cut, " \n"); idx > n/2 {
+		cut = cut[:idx]
+	}
+	// do not leave half of escaped entity
+	if amp := strings.LastIndex(cut, "&"); amp >= 0 && !strings.Contains(cut[amp:], ";") {
+		cut = cut[:amp]
+	}
+	return strings.TrimSpace(cut) + " …"
+}
+
+// Hashtags converts skills into telegram hashtags
+func Hashtags(skills []string) string {
+	tags := make([]string, 0, len(skills))
+	for _, skill := range skills {
+		tag := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return '_'
+		}, skill)
+		tag = strings.Trim(tag, "_")
+		if tag != "" {
+			tags = append(tags, "#"+tag)
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+func money(v float64) string {
+	return "$" + strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Rate returns budget or hourly range line
+func Rate(job model.Job) string {
+	switch {
+	case job.HourlyMin > 0 && job.HourlyMax > job.HourlyMin:
+		return "Hourly: " + money(job.HourlyMin) + "-" + money(job.HourlyMax)
+	case job.HourlyMin > 0:
+		return "Hourly: " + money(job.HourlyMin)
+	case job.Budget > 0:
+		return "Budget: " + money(job.Budget)
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package format
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// telegram supported tags, aliases are mapped to the canonical ones
+var tgTags = map[atom.Atom]string{
+	atom.B:          "b",
+	atom.Strong:     "b",
+	atom.I:          "i",
+	atom.Em:         "i",
+	atom.U:          "u",
+	atom.Ins:        "u",
+	atom.S:          "s",
+	atom.Strike:     "s",
+	atom.Del:        "s",
+	atom.A:          "a",
+	atom.Code:       "code",
+	atom.Pre:        "pre",
+	atom.Blockquote: "blockquote",
+}
+
+var blankRe = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+
+type converter struct {
+	out   strings.Builder
+	stack []string
+	plain bool
+}
+
+func (c *converter) text(s string) {
+	s = strings.ReplaceAll(s, " ", " ")
+	c.out.WriteString(EscapeHtml(s))
+}
+
+func (c *converter) opened(tag string) bool {
+	for _, v := range c.stack {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *converter) open(tag string, attrs []html.Attribute) {
+	if c.plain {
+		return
+	}
+	// telegram rejects nested links and any markup inside pre/code
+	if c.opened("code") || c.opened("pre") && tag != "code" || tag == "a" && c.opened("a") {
+		return
+	}
+	if tag == "a" {
+		href := ""
+		for _, attr := range attrs {
+			if attr.Key == "href" {
+				href = strings.TrimSpace(attr.Val)
+			}
+		}
+		if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+			return
+		}
+		c.out.WriteString(`<a href="` + EscapeAttr(href) + `">`)
+	} else {
+		c.out.WriteString("<" + tag + ">")
+	}
+	c.stack = append(c.stack, tag)
+}
+
+// close closes tags up to the last opened tag, unbalanced closing tags are ignored
+func (c *converter) close(tag string) {
+	if !c.opened(tag) {
+		return
+	}
+	for len(c.stack) > 0 {
+		last := c.stack[len(c.stack)-1]
+		c.stack = c.stack[:len(c.stack)-1]
+		c.out.WriteString("</" + last + ">")
+		if last == tag {
+			return
+		}
+	}
+}
+
+func (c *converter) convert(s string) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				c.text(string(z.Raw()))
+			}
+			for len(c.stack) > 0 {
+				c.close(c.stack[len(c.stack)-1])
+			}
+			result := blankRe.ReplaceAllString(c.out.String(), "\n\n")
+			return strings.TrimSpace(result)
+		case html.TextToken:
+			c.text(string(z.Text()))
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.Br:
+				c.out.WriteString("\n")
+				continue
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				if tt == html.StartTagToken {
+					c.out.WriteString("\n")
+					c.open("b", nil)
+				} else if tt == html.EndTagToken {
+					c.close("b")
+					c.out.WriteString("\n")
+				}
+				continue
+			case atom.P, atom.Div, atom.Ul, atom.Ol, atom.Table, atom.Tr:
+				c.out.WriteString("\n")
+				continue
+			case atom.Li:
+				if tt == html.StartTagToken {
+					c.out.WriteString("\n• ")
+				}
+				continue
+			case atom.Td, atom.Th:
+				if tt == html.EndTagToken {
+					c.out.WriteString(" ")
+				}
+				continue
+			case atom.Script, atom.Style:
+				if tt == html.StartTagToken {
+					z.Next() // raw text of the element
+				}
+				continue
+			}
+			tag, ok := tgTags[t.DataAtom]
+			if !ok {
+				continue
+			}
+			switch tt {
+			case html.StartTagToken:
+				c.open(tag, t.Attr)
+			case html.EndTagToken:
+				c.close(tag)
+			}
+		}
+	}
+}
+
+// Html converts any html into the subset supported by telegram
+func Html(s string) string {
+	c := converter{}
+	return c.convert(s)
+}
+
+// Text converts any html into escaped plain text
+func Text(s string) string {
+	c := converter{plain: true}
+	return c.convert(s)
+}
+
+func EscapeHtml(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	return s
+}
+
+func EscapeAttr(s string) string {
+	return strings.ReplaceAll(EscapeHtml(s), `"`, "&quot;")
+}
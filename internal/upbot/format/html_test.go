@@ -0,0 +1,112 @@
+package format
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// golden tests convert testdata/NAME.html and compare with testdata/NAME.golden,
+// parts are split by the limit when it is set
+var goldenTests = []struct {
+	name  string
+	limit int
+}{
+	{name: "upwork_hourly"},
+	{name: "upwork_fixed"},
+	{name: "entities"},
+	{name: "unbalanced"},
+	{name: "unknown_tags"},
+	{name: "nested"},
+	{name: "split_long", limit: 300},
+	{name: "upwork_hourly", limit: 120},
+}
+
+// capturedTests adds descriptions of real feed items, testdata/real_*.html, see testdata/README.md
+func capturedTests(t *testing.T) []string {
+	paths, err := filepath.Glob(filepath.Join("testdata", "real_*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, path := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".html"))
+	}
+	return names
+}
+
+func render(input string, limit int) string {
+	b := strings.Builder{}
+	html := Html(input)
+	b.WriteString("== html ==\n" + html + "\n")
+	b.WriteString("== text ==\n" + Text(input) + "\n")
+	if limit > 0 {
+		for i, part := range Split(html, limit) {
+			b.WriteString(fmt.Sprintf("== part %d, length %d ==\n%s\n", i+1, Length(part), part))
+		}
+	}
+	return b.String()
+}
+
+func TestGolden(t *testing.T) {
+	tests := goldenTests
+	for _, name := range capturedTests(t) {
+		tests = append(tests, struct {
+			name  string
+			limit int
+		}{name: name, limit: MaxLength})
+	}
+	for _, tt := range tests {
+		name := tt.name
+		if tt.limit > 0 {
+			name = fmt.Sprintf("%s_%d", tt.name, tt.limit)
+		}
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", tt.name+".html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := render(string(input), tt.limit)
+
+			goldenPath := filepath.Join("testdata", name+".golden")
+			if *update {
+				err := os.WriteFile(goldenPath, []byte(got), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s mismatch, run go test -update to see the diff\ngot:\n%s\nwant:\n%s", goldenPath, got, want)
+			}
+		})
+	}
+}
+
+func TestSplitLimit(t *testing.T) {
+	for _, tt := range goldenTests {
+		if tt.limit == 0 {
+			continue
+		}
+		input, err := os.ReadFile(filepath.Join("testdata", tt.name+".html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range Split(Html(string(input)), tt.limit) {
+			if Length(part) > tt.limit {
+				t.Errorf("%s: part is longer than %d: %d", tt.name, tt.limit, Length(part))
+			}
+			if strings.Count(part, "<b>") != strings.Count(part, "</b>") || strings.Count(part, "<i>") != strings.Count(part, "</i>") {
+				t.Errorf("%s: unbalanced part: %s", tt.name, part)
+			}
+		}
+	}
+}
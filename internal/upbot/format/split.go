@@ -0,0 +1,192 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLength is telegram message limit in utf-16 code units of the visible text
+const MaxLength = 4096
+
+const (
+	LongSplit    = "split"
+	LongTruncate = "truncate"
+)
+
+const readMore = "Read more"
+
+type breakKind int
+
+const (
+	breakNone breakKind = iota
+	breakWord
+	breakLine
+	breakParagraph
+)
+
+type token struct {
+	raw   string
+	width int
+	tag   string // tag name for open/close tags
+	close bool
+}
+
+// tokenize splits telegram html into tags, entities and single runes
+func tokenize(s string) (tokens []token) {
+	for len(s) > 0 {
+		switch {
+		case s[0] == '<':
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			raw := s[:end+1]
+			name := strings.TrimPrefix(raw[1:len(raw)-1], "/")
+			if idx := strings.IndexAny(name, " \t\n"); idx >= 0 {
+				name = name[:idx]
+			}
+			tokens = append(tokens, token{raw: raw, tag: name, close: strings.HasPrefix(raw, "</")})
+			s = s[len(raw):]
+		case s[0] == '&':
+			end := strings.IndexByte(s, ';')
+			if end < 0 || end > 10 {
+				end = 0
+			}
+			tokens = append(tokens, token{raw: s[:end+1], width: 1})
+			s = s[end+1:]
+		default:
+			r, size := utf8.DecodeRuneInString(s)
+			width := 1
+			if r >= 0x10000 {
+				width = 2
+			}
+			tokens = append(tokens, token{raw: s[:size], width: width})
+			s = s[size:]
+		}
+	}
+	return
+}
+
+// Length returns length of the visible text the way telegram counts it
+func Length(s string) (result int) {
+	for _, t := range tokenize(s) {
+		result += t.width
+	}
+	return
+}
+
+func replay(stack []token, tokens []token) []token {
+	stack = append([]token{}, stack...)
+	for _, t := range tokens {
+		if t.tag == "" {
+			continue
+		}
+		if !t.close {
+			stack = append(stack, t)
+			continue
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].tag == t.tag {
+				stack = append(stack[:i], stack[i+1:]...)
+				break
+			}
+		}
+	}
+	return stack
+}
+
+func closing(stack []token) string {
+	b := strings.Builder{}
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString("</" + stack[i].tag + ">")
+	}
+	return b.String()
+}
+
+func opening(stack []token) string {
+	b := strings.Builder{}
+	for _, t := range stack {
+		b.WriteString(t.raw)
+	}
+	return b.String()
+}
+
+func isSpace(t token) bool {
+	return t.raw == " " || t.raw == "\n"
+}
+
+// Split splits html into parts not longer than limit, preferably by paragraphs,
+// tags opened at the split point are closed and re-opened in the next part
+func Split(s string, limit int) (parts []string) {
+	tokens := tokenize(s)
+	stack := []token{}
+	start := 0
+
+	for start < len(tokens) {
+		width := 0
+		cut := [breakParagraph + 1]int{}
+		i := start
+		for ; i < len(tokens) && width+tokens[i].width <= limit; i++ {
+			width += tokens[i].width
+			// paragraph and line breaks are preferred only if they do not make too short part
+			switch {
+			case tokens[i].raw == "\n" && i > start && tokens[i-1].raw == "\n" && width >= limit/2:
+				cut[breakParagraph] = i + 1
+			case tokens[i].raw == "\n" && width >= limit/2:
+				cut[breakLine] = i + 1
+			case isSpace(tokens[i]):
+				cut[breakWord] = i + 1
+			}
+		}
+
+		end := len(tokens)
+		if i < len(tokens) {
+			end = i
+			for kind := breakParagraph; kind > breakNone; kind-- {
+				if cut[kind] > start {
+					end = cut[kind]
+					break
+				}
+			}
+			if end == start { // single token longer than limit
+				end = start + 1
+			}
+		}
+
+		part := tokens[start:end]
+		endStack := replay(stack, part)
+		b := strings.Builder{}
+		b.WriteString(opening(stack))
+		for _, t := range part {
+			b.WriteString(t.raw)
+		}
+		text := strings.TrimSpace(b.String()) + closing(endStack)
+		if Length(text) > 0 {
+			parts = append(parts, text)
+		}
+
+		stack = endStack
+		start = end
+		for start < len(tokens) && isSpace(tokens[start]) {
+			start++
+		}
+	}
+
+	return parts
+}
+
+// Truncate cuts html to the limit and appends read more link
+func Truncate(s string, limit int, link string) string {
+	if Length(s) <= limit {
+		return s
+	}
+	suffix := ""
+	if link != "" {
+		suffix = "\n<a href=\"" + EscapeAttr(link) + "\">" + readMore + "</a>"
+	}
+	parts := Split(s, limit-Length(suffix)-2)
+	if len(parts) == 0 {
+		return suffix
+	}
+	return parts[0] + " …" + suffix
+}
@@ -1,5 +1,48 @@
 package model
 
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+)
+
 func (k JobInfoKey) Key() string {
 	return (k.User + ";" + k.GUID)
 }
+
+// OutboxKey keeps reminders apart from delivery of the job itself
+func (j JobInfo) OutboxKey() string {
+	if j.Reminder {
+		return j.Key.Key() + ";remind"
+	}
+	return j.Key.Key()
+}
+
+// ID identifies sink in delivery state of the job
+func (s SinkInfo) ID() string {
+	sum := sha1.Sum([]byte(s.Url))
+	return s.Kind + ":" + hex.EncodeToString(sum[:4])
+}
+
+func (w Workspace) Key() string {
+	return WorkspacePrefix + w.ID
+}
+
+// CanEdit is true for roles allowed to change feeds and settings
+func (r Role) CanEdit() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+// JobID is short id of the job for callback data
+func JobID(guid string) string {
+	sum := sha1.Sum([]byte(guid))
+	return hex.EncodeToString(sum[:6])
+}
+
+func (c Claim) Key() string {
+	return strconv.FormatInt(c.Chat, 10) + ";" + c.JobID
+}
+
+func (s SavedJob) Key() string {
+	return s.User + ";" + JobID(s.RSS.GUID)
+}
@@ -12,17 +12,42 @@ const (
 	WaitingNone WaitingFeedKind = iota
 	WaitingAdd
 	WaitingDel
+	WaitingDraft
 )
 
 const (
-	DBPathJobs  = "data/jobs"
-	DBPathUsers = "data/users"
+	DBPathJobs   = "data/jobs"
+	DBPathUsers  = "data/users"
+	DBPathOutbox = "data/outbox"
+	DBPathDead   = "data/dead"
+	DBPathDigest = "data/digest"
+
+	DBPathWorkspaces = "data/workspaces"
+	DBPathClaims     = "data/claims"
+	DBPathContent    = "data/content"
+	DBPathSaved      = "data/saved"
+	DBPathIndex      = "data/index"
+	DBPathTrends     = "data/trends"
+	DBPathClients    = "data/clients"
+	DBPathInvites    = "data/invites"
+	DBPathEvents     = "data/events"
+)
+
+// AccessState is approval of the user, users before access control are approved
+type AccessState string
+
+const (
+	AccessApproved AccessState = ""
+	AccessPending  AccessState = "pending"
+	AccessDenied   AccessState = "denied"
 )
 
 type FeedInfo struct {
-	IsActive bool
-	Title    string
-	Url      string
+	IsActive  bool
+	Title     string
+	Url       string
+	ChatID    int64 // group or channel to route jobs, user's chat if 0
+	ChatTitle string
 }
 
 type UserInfo struct {
@@ -31,8 +56,40 @@ type UserInfo struct {
 	ChannelID      int64
 	Pull           time.Duration
 	Active         bool
+	Suspended      bool // by admin, the user cannot /start
+	Blocked        bool // the user blocked the bot, reactivated on unblock
+	Access         AccessState
+	Plan           string
+	PlanExpires    time.Time // paid plan is downgraded to free after it, never if zero
 	WaitingFeedUrl WaitingFeedKind
 	Feeds          []FeedInfo
+	Layout         string
+	LongMode       string
+	Sinks          []SinkInfo
+	Workspace      string // current workspace for /ws commands
+	Templates      []Template
+	Timezone       string   // IANA name for /stats, UTC if empty
+	Keywords       []string // words to watch for trend alerts
+	Clients        []ClientMark
+	Draft          Draft // proposal waiting for user's edit
+}
+
+// Template is user's cover letter with {title}, {country}, {skills}, etc placeholders
+type Template struct {
+	Name string
+	Text string
+}
+
+type Draft struct {
+	JobID string
+	Text  string
+}
+
+// SinkInfo is additional destination for jobs, Url may be encrypted
+type SinkInfo struct {
+	Kind string
+	Url  string
+	Mode string
 }
 
 type JobInfoKey struct {
@@ -43,9 +100,130 @@ type JobInfoKey struct {
 type JobValue struct {
 	Published time.Time
 	Processed time.Time
+	Feed      string // title of the feed the job came from
 }
 
 type JobInfo struct {
-	Key JobInfoKey
-	RSS gofeed.Item
+	Key  JobInfoKey
+	RSS  gofeed.Item
+	Chat int64
+	Feed string
+	// Reminder is saved job sent again, it does not change the processed job
+	Reminder bool
+}
+
+// OutboxItem is job waiting for delivery, or failed permanently in dead-letter list
+type OutboxItem struct {
+	Job      JobInfo
+	Done     []string       // sinks the job is delivered to
+	Parts    map[string]int // parts of long message sent to the sink, sending is resumed after them
+	Attempts int
+	NextTry  time.Time
+	LastErr  string
+	Failed   time.Time
+}
+
+// Job is upwork rss item parsed into fields
+type Job struct {
+	GUID        string
+	Title       string
+	Link        string
+	Description string
+	Published   time.Time
+	Budget      float64
+	HourlyMin   float64
+	HourlyMax   float64
+	Category    string
+	Skills      []string
+	Country     string
+	// client signals, present on some feeds only
+	ClientSpent    float64
+	ClientRating   float64
+	ClientVerified bool
+	ClientJobs     int
+	ClientSince    string
+}
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// WorkspacePrefix marks workspace jobs in JobInfoKey.User
+const WorkspacePrefix = "ws:"
+
+// Workspace owns feeds shared by several members
+type Workspace struct {
+	ID        string
+	Name      string
+	Members   map[string]Role
+	Invites   map[string]Role
+	Feeds     []FeedInfo
+	ChatID    int64 // shared chat, every member gets jobs if 0
+	ChatTitle string
+}
+
+type ClaimState string
+
+const (
+	ClaimNone    ClaimState = ""
+	ClaimTaken   ClaimState = "taken"
+	ClaimSkipped ClaimState = "skipped"
+	ClaimApplied ClaimState = "applied"
+)
+
+// Claim is state of the job message in a shared chat
+type Claim struct {
+	Chat     int64
+	JobID    string
+	ClientID string
+	Title    string
+	Link     string
+	Text     string // sent html to edit the message
+	State    ClaimState
+	User     string
+	UserName string
+	Updated  time.Time
+}
+
+// SavedJob is user's bookmark, the job is sent again at RemindAt if it is set
+type SavedJob struct {
+	User     string
+	RSS      gofeed.Item
+	Saved    time.Time
+	RemindAt time.Time
+}
+
+// JobContent is fetched job stored once for all users
+type JobContent struct {
+	Job    Job
+	RSS    gofeed.Item
+	Stored time.Time
+}
+
+// Trend is hourly counter of new jobs for feed or keyword
+type Trend struct {
+	Buckets map[int64]int // unix hour to jobs
+	Started time.Time
+	Alerted time.Time
+}
+
+// ClientMark is client followed or marked as bad by the user
+type ClientMark struct {
+	ID    string
+	Label string
+	Bad   bool
+	Added time.Time
+}
+
+// UserEvent is lifecycle change of the user or of the user's chat
+type UserEvent struct {
+	User   string
+	Kind   string
+	Chat   int64
+	Detail string
+	Time   time.Time
 }
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"html"
+	"strings"
+
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+)
+
+const discordMaxLength = 2000
+
+// Discord sends to channel webhook
+type Discord struct {
+	Url string
+}
+
+func (d Discord) SendJob(job model.Job) error {
+	lines := []string{"**[" + job.Title + "](" + job.Link + ")**"}
+	if rate := format.Rate(job); rate != "" {
+		lines = append(lines, rate)
+	}
+	if job.Country != "" {
+		lines = append(lines, format.Flag(job.Country)+" "+job.Country)
+	}
+	if tags := format.Hashtags(job.Skills); tags != "" {
+		lines = append(lines, tags)
+	}
+	head := strings.Join(lines, "\n") + "\n\n"
+	if free := discordMaxLength - len([]rune(head)) - 10; free > 0 {
+		head += html.UnescapeString(format.Shorten(free, format.Text(job.Description)))
+	}
+
+	return d.SendText(head)
+}
+
+func (d Discord) SendText(text string) error {
+	return postJSON(d.Url, map[string]string{"content": format.Shorten(discordMaxLength-2, text)})
+}
+
+func (d Discord) Capabilities() Capabilities {
+	return Capabilities{MaxLength: discordMaxLength}
+}
@@ -0,0 +1,274 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	KindEmail = "email"
+
+	ModeInstant = "instant"
+	ModeDigest  = "digest"
+
+	msgIdDomain = "goupbot"
+)
+
+// Email sends every job as a separate email or collects them into digest
+type Email struct {
+	To   string
+	Mode string
+}
+
+var wordRe = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+func hash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// threadId is the same for reposts of the job: same normalized title and country
+func threadId(job model.Job) string {
+	words := wordRe.FindAllString(strings.ToLower(job.Title), -1)
+	return "<" + hash(strings.Join(words, " ")+"|"+job.Country) + "@" + msgIdDomain + ">"
+}
+
+func jobText(job model.Job) string {
+	lines := []string{job.Title, job.Link}
+	if rate := format.Rate(job); rate != "" {
+		lines = append(lines, rate)
+	}
+	if job.Country != "" {
+		lines = append(lines, "Country: "+job.Country)
+	}
+	if len(job.Skills) > 0 {
+		lines = append(lines, "Skills: "+strings.Join(job.Skills, ", "))
+	}
+	lines = append(lines, "", html.UnescapeString(format.Text(job.Description)))
+	return strings.Join(lines, "\n")
+}
+
+func jobHtml(job model.Job) string {
+	b := strings.Builder{}
+	b.WriteString(`<h3><a href="` + format.EscapeAttr(job.Link) + `">` + format.EscapeHtml(job.Title) + "</a></h3>\n")
+	if rate := format.Rate(job); rate != "" {
+		b.WriteString("<p>" + rate + "</p>\n")
+	}
+	if job.Country != "" {
+		b.WriteString("<p>" + format.Flag(job.Country) + " " + format.EscapeHtml(job.Country) + "</p>\n")
+	}
+	if len(job.Skills) > 0 {
+		b.WriteString("<p>" + format.EscapeHtml(strings.Join(job.Skills, ", ")) + "</p>\n")
+	}
+	b.WriteString("<p>" + strings.ReplaceAll(format.Html(job.Description), "\n", "<br>\n") + "</p>\n")
+	return b.String()
+}
+
+func encodeQP(s string) string {
+	buf := bytes.Buffer{}
+	w := quotedprintable.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+// buildMessage creates multipart/alternative email with text and html parts
+func buildMessage(from, to, subject string, headers map[string]string, text, htmlBody string) []byte {
+	boundary := "goupbot-" + hash(subject+time.Now().String())
+	b := strings.Builder{}
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	for k, v := range headers {
+		b.WriteString(k + ": " + v + "\r\n")
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString(`Content-Type: multipart/alternative; boundary="` + boundary + "\"\r\n\r\n")
+	for _, part := range []struct{ kind, body string }{{"text/plain", text}, {"text/html", "<html><body>\n" + htmlBody + "</body></html>"}} {
+		b.WriteString("--" + boundary + "\r\n")
+		b.WriteString("Content-Type: " + part.kind + "; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		b.WriteString(encodeQP(part.body) + "\r\n")
+	}
+	b.WriteString("--" + boundary + "--\r\n")
+	return []byte(b.String())
+}
+
+// smtpRootCAs verifies smtp server, system pool if nil
+var smtpRootCAs *x509.CertPool
+
+// sendMail sends message with implicit tls or STARTTLS and auth from config
+func sendMail(to string, msg []byte) error {
+	cfg := config.GetConfig().Smtp
+	if cfg.Host == "" {
+		return errors.New("smtp is not configured")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if cfg.TLS {
+			port = 465
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, RootCAs: smtpRootCAs}
+
+	implicit := cfg.TLS || port == 465
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if implicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.StartTLS && !implicit {
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.User != "" {
+		err = c.Auth(smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host))
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(cfg.From)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (e Email) SendJob(job model.Job) error {
+	if e.Mode == ModeDigest {
+		return pudge.Set(model.DBPathDigest, e.To+";"+job.GUID, job)
+	}
+
+	thread := threadId(job)
+	headers := map[string]string{
+		"Message-ID":  "<" + hash(job.GUID) + "@" + msgIdDomain + ">",
+		"In-Reply-To": thread,
+		"References":  thread,
+	}
+	msg := buildMessage(config.GetConfig().Smtp.From, e.To, "[upwork] "+job.Title, headers, jobText(job), jobHtml(job))
+	return sendMail(e.To, msg)
+}
+
+func (e Email) SendText(text string) error {
+	body := html.UnescapeString(format.Text(text))
+	msg := buildMessage(config.GetConfig().Smtp.From, e.To, "goupbot", nil, body, format.Html(text))
+	return sendMail(e.To, msg)
+}
+
+func (e Email) Capabilities() Capabilities {
+	return Capabilities{Html: true}
+}
+
+// FlushDigest sends collected jobs, one email per recipient
+func FlushDigest() {
+	keys, err := pudge.Keys(model.DBPathDigest, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	jobs := map[string][]model.Job{}
+	jobKeys := map[string][][]byte{}
+	for _, key := range keys {
+		job := model.Job{}
+		err := pudge.Get(model.DBPathDigest, key, &job)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		to := strings.SplitN(string(key), ";", 2)[0]
+		jobs[to] = append(jobs[to], job)
+		jobKeys[to] = append(jobKeys[to], key)
+	}
+
+	for to, list := range jobs {
+		texts, htmls := []string{}, []string{}
+		for _, job := range list {
+			texts = append(texts, jobText(job))
+			htmls = append(htmls, jobHtml(job))
+		}
+		subject := fmt.Sprintf("[upwork] %d new jobs", len(list))
+		msg := buildMessage(config.GetConfig().Smtp.From, to, subject, nil,
+			strings.Join(texts, "\n\n-----\n\n"), strings.Join(htmls, "<hr>\n"))
+		err := sendMail(to, msg)
+		if err != nil {
+			logrus.WithField("jobs", len(list)).Error(err)
+			continue
+		}
+		for _, key := range jobKeys[to] {
+			err := pudge.Delete(model.DBPathDigest, key)
+			if err != nil {
+				logrus.Panic(err)
+			}
+		}
+	}
+}
+
+// RunDigest flushes digest emails by the configured interval
+func RunDigest(bt *bot.BotStruct) {
+	defer bt.Wg.Done()
+
+	interval := config.GetDigestInterval()
+	for {
+		select {
+		case <-time.After(interval):
+			FlushDigest()
+		case <-bt.Ctx.Done():
+			logrus.Debug("digest: done")
+			return
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/recoilme/pudge"
+)
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSmtp accepts messages without auth and sends them to the channel
+func fakeSmtp(t *testing.T, l net.Listener) <-chan smtpMessage {
+	t.Cleanup(func() { l.Close() })
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSmtp(conn, messages)
+		}
+	}()
+	return messages
+}
+
+func serveSmtp(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	reply("220 fake ESMTP")
+	msg := smtpMessage{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = smtpMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.To = append(msg.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			data := strings.Builder{}
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.Data = data.String()
+			messages <- msg
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func setSmtp(t *testing.T, l net.Listener, implicitTLS bool) {
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{}
+	cfg.Smtp.Host = host
+	cfg.Smtp.Port, _ = strconv.Atoi(port)
+	cfg.Smtp.From = "bot@example.com"
+	cfg.Smtp.TLS = implicitTLS
+	config.Set(cfg)
+}
+
+func receive(t *testing.T, messages <-chan smtpMessage) (smtpMessage, *mail.Message) {
+	select {
+	case msg := <-messages:
+		parsed, err := mail.ReadMessage(strings.NewReader(msg.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg, parsed
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+	return smtpMessage{}, nil
+}
+
+// parts returns decoded bodies of multipart/alternative message by content type
+func parts(t *testing.T, m *mail.Message) map[string]string {
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type: %s", m.Header.Get("Content-Type"))
+	}
+	result := map[string]string{}
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[p.Header.Get("Content-Type")] = string(body)
+	}
+}
+
+func checkParts(t *testing.T, m *mail.Message, text []string, html []string) {
+	p := parts(t, m)
+	for kind, want := range map[string][]string{"text/plain; charset=utf-8": text, "text/html; charset=utf-8": html} {
+		body, ok := p[kind]
+		if !ok {
+			t.Errorf("no %s part", kind)
+		}
+		for _, s := range want {
+			if !strings.Contains(body, s) {
+				t.Errorf("no %q in %s part:\n%s", s, kind, body)
+			}
+		}
+	}
+}
+
+var testJob = model.Job{
+	Title:       "Go developer for Telegram bot",
+	Link:        "https://www.upwork.com/jobs/~01",
+	GUID:        "https://www.upwork.com/jobs/~01?source=rss",
+	Country:     "Germany",
+	Description: "Need <b>Go</b> &amp; RSS",
+}
+
+func TestSendJobInstant(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := fakeSmtp(t, l)
+	setSmtp(t, l, false)
+
+	e := Email{To: "user@example.com", Mode: ModeInstant}
+	if err := e.SendJob(testJob); err != nil {
+		t.Fatal(err)
+	}
+	msg, m := receive(t, messages)
+	if msg.From != "bot@example.com" || len(msg.To) != 1 || msg.To[0] != "user@example.com" {
+		t.Errorf("unexpected envelope: %v %v", msg.From, msg.To)
+	}
+	if m.Header.Get("Subject") != "[upwork] "+testJob.Title {
+		t.Errorf("unexpected subject: %s", m.Header.Get("Subject"))
+	}
+	checkParts(t, m,
+		[]string{"Go developer for Telegram bot", "Country: Germany", "Need Go & RSS"},
+		[]string{`<a href="https://www.upwork.com/jobs/~01">Go developer for Telegram bot</a>`, "Need <b>Go</b> &amp; RSS"})
+
+	// repost of the job with another guid is in the same thread
+	repost := testJob
+	repost.GUID = "https://www.upwork.com/jobs/~02?source=rss"
+	repost.Title = "Go Developer for telegram bot!"
+	if err := e.SendJob(repost); err != nil {
+		t.Fatal(err)
+	}
+	_, m2 := receive(t, messages)
+	if m.Header.Get("Message-ID") == m2.Header.Get("Message-ID") {
+		t.Error("Message-ID must differ")
+	}
+	thread := m.Header.Get("In-Reply-To")
+	if thread == "" || m2.Header.Get("In-Reply-To") != thread || m2.Header.Get("References") != thread {
+		t.Errorf("reposts must be in one thread: %s %s %s", thread, m2.Header.Get("In-Reply-To"), m2.Header.Get("References"))
+	}
+}
+
+func TestFlushDigest(t *testing.T) {
+	wd, _ := os.Getwd()
+	t.Cleanup(func() {
+		pudge.CloseAll()
+		os.Chdir(wd)
+	})
+	os.Chdir(t.TempDir())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := fakeSmtp(t, l)
+	setSmtp(t, l, false)
+
+	e := Email{To: "user@example.com", Mode: ModeDigest}
+	second := testJob
+	second.GUID = "https://www.upwork.com/jobs/~03?source=rss"
+	second.Title = "Second job"
+	for _, job := range []model.Job{testJob, second} {
+		if err := e.SendJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-messages:
+		t.Fatal("digest must not be sent before flush")
+	default:
+	}
+
+	FlushDigest()
+	msg, m := receive(t, messages)
+	if len(msg.To) != 1 || msg.To[0] != "user@example.com" {
+		t.Errorf("unexpected recipients: %v", msg.To)
+	}
+	if m.Header.Get("Subject") != "[upwork] 2 new jobs" {
+		t.Errorf("unexpected subject: %s", m.Header.Get("Subject"))
+	}
+	checkParts(t, m,
+		[]string{testJob.Title, "-----", "Second job"},
+		[]string{testJob.Title, "<hr>", "Second job"})
+
+	count, err := pudge.Count(model.DBPathDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("digest is not cleared: %d", count)
+	}
+}
+
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestSendImplicitTLS(t *testing.T) {
+	cert, pool := selfSigned(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := fakeSmtp(t, l)
+	setSmtp(t, l, true)
+	smtpRootCAs = pool
+	t.Cleanup(func() { smtpRootCAs = nil })
+
+	e := Email{To: "user@example.com", Mode: ModeInstant}
+	if err := e.SendText("<b>hello</b>"); err != nil {
+		t.Fatal(err)
+	}
+	_, m := receive(t, messages)
+	checkParts(t, m, []string{"hello"}, []string{"<b>hello</b>"})
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	KindSlack   = "slack"
+	KindDiscord = "discord"
+	KindWebhook = "webhook"
+)
+
+var Kinds = []string{KindSlack, KindDiscord, KindWebhook, KindEmail}
+
+// Capabilities describe what destination can show
+type Capabilities struct {
+	Html      bool
+	Buttons   bool
+	MaxLength int
+}
+
+// Notifier is a destination for jobs and text messages
+type Notifier interface {
+	SendJob(job model.Job) error
+	SendText(text string) error
+	Capabilities() Capabilities
+}
+
+var errInternalAddr = errors.New("internal addresses are not allowed")
+
+// isInternal returns true for addresses which must not be reachable by users' sinks
+func isInternal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// dialer checks the address at connect time, so dns cannot be switched to internal one after validation
+var dialer = &net.Dialer{
+	Timeout: 10 * time.Second,
+	Control: func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || isInternal(ip) {
+			return errInternalAddr
+		}
+		return nil
+	},
+}
+
+var client = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &http.Transport{DialContext: dialer.DialContext},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// ValidateUrl checks the url of the sink: https only, slack and discord on their own hosts,
+// webhooks on public addresses
+func ValidateUrl(kind string, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return errors.New("incorrect url")
+	}
+	if u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return errors.New("https url expected")
+	}
+	host := strings.ToLower(u.Hostname())
+	switch kind {
+	case KindSlack:
+		if host != "hooks.slack.com" {
+			return errors.New("slack url must be on hooks.slack.com")
+		}
+	case KindDiscord:
+		if (host != "discord.com" && host != "discordapp.com") || !strings.HasPrefix(u.Path, "/api/webhooks/") {
+			return errors.New("discord url must be discord.com/api/webhooks/...")
+		}
+	case KindWebhook:
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return errors.New("cannot resolve " + host)
+		}
+		for _, ip := range ips {
+			if isInternal(ip) {
+				return errInternalAddr
+			}
+		}
+	}
+	return nil
+}
+
+func postJSON(rawUrl string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(rawUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.Is(err, errInternalAddr) {
+			// permanent error, it is not wrapped as network one
+			return fmt.Errorf("%s: %s", secret.Redact(rawUrl), errInternalAddr)
+		}
+		if errors.As(err, &urlErr) {
+			// url.Error repeats the url with the secret token
+			return fmt.Errorf("%s: %w", secret.Redact(rawUrl), urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// the body is not returned, the error is shown to the user
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		logrus.WithField("url", secret.Redact(rawUrl)).Warnf("%s: %s", resp.Status, msg)
+		return StatusError{Url: secret.Redact(rawUrl), Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// StatusError is non-2xx reply of the destination
+type StatusError struct {
+	Url    string
+	Code   int
+	Status string
+}
+
+func (e StatusError) Error() string {
+	return e.Url + ": " + e.Status
+}
+
+// Transient returns true if the request may succeed later
+func (e StatusError) Transient() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// New creates notifier for the sink stored in user settings
+func New(sink model.SinkInfo) (Notifier, error) {
+	url, err := secret.Decrypt(sink.Url)
+	if err != nil {
+		return nil, err
+	}
+	switch sink.Kind {
+	case KindSlack:
+		return Slack{Url: url}, nil
+	case KindDiscord:
+		return Discord{Url: url}, nil
+	case KindWebhook:
+		return Webhook{Url: url}, nil
+	case KindEmail:
+		return Email{To: url, Mode: sink.Mode}, nil
+	}
+	return nil, fmt.Errorf("unknown sink kind: %s", sink.Kind)
+}
+
+func IsKind(kind string) bool {
+	for _, v := range Kinds {
+		if v == kind {
+			return true
+		}
+	}
+	return false
+}
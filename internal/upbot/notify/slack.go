@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"html"
+	"strings"
+
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+)
+
+const slackMaxLength = 3000
+
+// Slack sends to incoming webhook
+type Slack struct {
+	Url string
+}
+
+func slackEscape(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	return strings.ReplaceAll(s, ">", "&gt;")
+}
+
+func (s Slack) SendJob(job model.Job) error {
+	lines := []string{"*<" + job.Link + "|" + slackEscape(job.Title) + ">*"}
+	if rate := format.Rate(job); rate != "" {
+		lines = append(lines, rate)
+	}
+	if job.Country != "" {
+		lines = append(lines, format.Flag(job.Country)+" "+slackEscape(job.Country))
+	}
+	if tags := format.Hashtags(job.Skills); tags != "" {
+		lines = append(lines, tags)
+	}
+	desc := html.UnescapeString(format.Shorten(slackMaxLength/2, format.Text(job.Description)))
+	lines = append(lines, "", slackEscape(desc))
+
+	return s.SendText(strings.Join(lines, "\n"))
+}
+
+func (s Slack) SendText(text string) error {
+	return postJSON(s.Url, map[string]string{"text": text})
+}
+
+func (s Slack) Capabilities() Capabilities {
+	return Capabilities{MaxLength: slackMaxLength}
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"github.com/inv2004/goupbot/internal/upbot/model"
+)
+
+// Webhook posts json {"type": "job", "job": {...}} or {"type": "text", "text": "..."}
+type Webhook struct {
+	Url string
+}
+
+type webhookPayload struct {
+	Type string     `json:"type"`
+	Job  *model.Job `json:"job,omitempty"`
+	Text string     `json:"text,omitempty"`
+}
+
+func (w Webhook) SendJob(job model.Job) error {
+	return postJSON(w.Url, webhookPayload{Type: "job", Job: &job})
+}
+
+func (w Webhook) SendText(text string) error {
+	return postJSON(w.Url, webhookPayload{Type: "text", Text: text})
+}
+
+func (w Webhook) Capabilities() Capabilities {
+	return Capabilities{}
+}
@@ -0,0 +1,50 @@
+package plan
+
+import (
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+)
+
+const (
+	Free = "free"
+	Pro  = "pro"
+	Team = "team"
+)
+
+// Plan is quotas of the subscription tier
+type Plan struct {
+	Name     string
+	MaxFeeds int
+	MinPull  time.Duration
+	Filters  bool // budget, job type and category filters of /search
+	Digest   bool // email digest sinks
+}
+
+var Plans = map[string]Plan{
+	Free: {Name: Free, MaxFeeds: 2, MinPull: 5 * time.Minute},
+	Pro:  {Name: Pro, MaxFeeds: 10, MinPull: time.Minute, Filters: true, Digest: true},
+	Team: {Name: Team, MaxFeeds: 30, MinPull: time.Minute, Filters: true, Digest: true},
+}
+
+var Names = []string{Free, Pro, Team}
+
+func IsPlan(name string) bool {
+	_, ok := Plans[name]
+	return ok
+}
+
+// Expired is true if paid plan of the user is over and has to be downgraded
+func Expired(userInfo model.UserInfo) bool {
+	return userInfo.Plan != "" && userInfo.Plan != Free &&
+		!userInfo.PlanExpires.IsZero() && time.Now().After(userInfo.PlanExpires)
+}
+
+// Of returns current plan of the user, free if it is not set or expired
+func Of(userInfo model.UserInfo) Plan {
+	p, ok := Plans[userInfo.Plan]
+	if !ok || Expired(userInfo) {
+		return Plans[Free]
+	}
+	return p
+}
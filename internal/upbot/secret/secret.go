@@ -0,0 +1,113 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/sirupsen/logrus"
+)
+
+const encPrefix = "enc:"
+
+var (
+	tokenRe   = regexp.MustCompile(`(?i)\b(securityToken|userUid|orgUid)=[^&\s"'<>]+`)
+	webhookRe = regexp.MustCompile(`(?i)(hooks\.slack\.com/services|discord(?:app)?\.com/api/webhooks)/[^\s"'<>]+`)
+)
+
+// Redact hides private upwork rss parameters and webhook tokens in any text (urls, errors, messages)
+func Redact(s string) string {
+	s = tokenRe.ReplaceAllString(s, "${1}=***")
+	return webhookRe.ReplaceAllString(s, "${1}/***")
+}
+
+func gcm() (cipher.AEAD, error) {
+	key := config.GetStorageKey()
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt returns text as is if storage key is not configured
+func Encrypt(text string) (string, error) {
+	aead, err := gcm()
+	if err != nil {
+		return "", err
+	}
+	if aead == nil || strings.HasPrefix(text, encPrefix) {
+		return text, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(text), nil)
+	return encPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt accepts both encrypted and plain (stored before encryption was enabled) text
+func Decrypt(text string) (string, error) {
+	if !strings.HasPrefix(text, encPrefix) {
+		return text, nil
+	}
+	aead, err := gcm()
+	if err != nil {
+		return "", err
+	}
+	if aead == nil {
+		return "", errors.New("encrypted value found, but storage key is not configured")
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, encPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Hook redacts messages and fields of every logrus entry
+type Hook struct{}
+
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	for k, v := range entry.Data {
+		switch v := v.(type) {
+		case string:
+			entry.Data[k] = Redact(v)
+		case error:
+			entry.Data[k] = Redact(v.Error())
+		default:
+			s := fmt.Sprintf("%+v", v)
+			if r := Redact(s); r != s {
+				entry.Data[k] = r
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const accessInvitePrefix = "inv"
+
+// accessCommands are allowed before the admin approves the user
+var accessCommands = []string{"/start", "/help", "/ping"}
+
+// invitesMu serializes uses of invite codes, new users start in different workers
+var invitesMu sync.Mutex
+
+// useInvite consumes one use of the access invite code
+func useInvite(code string) bool {
+	if !strings.HasPrefix(code, accessInvitePrefix) {
+		return false
+	}
+	invitesMu.Lock()
+	defer invitesMu.Unlock()
+
+	uses := 0
+	err := pudge.Get(model.DBPathInvites, code, &uses)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return false
+		}
+		logrus.Panic(err)
+	}
+	if uses <= 1 {
+		err = pudge.Delete(model.DBPathInvites, code)
+	} else {
+		err = pudge.Set(model.DBPathInvites, code, uses-1)
+	}
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return true
+}
+
+// newUserAccess decides if the new user is approved by access mode of the config,
+// returns reply for the user if not
+func newUserAccess(sender *Sender, userId string, userName string, payload string) (model.AccessState, string) {
+	access := config.GetAccess()
+	if access.MaxUsers > 0 {
+		n, err := pudge.Count(model.DBPathUsers)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if n >= access.MaxUsers {
+			return model.AccessDenied, "Sorry, the bot has reached the maximum number of users"
+		}
+	}
+
+	switch access.Mode {
+	case config.AccessAllowlist:
+		if contains(access.Allow, userId) {
+			return model.AccessApproved, ""
+		}
+	case config.AccessInvite:
+		if useInvite(payload) {
+			return model.AccessApproved, ""
+		}
+	default:
+		return model.AccessApproved, ""
+	}
+
+	err := SendMsgToUser(sender, config.GetAdmin(), fmt.Sprintf("%suser %s @%s is waiting for approval: /approve %s or /deny %s",
+		AdminMessage, userId, escapeHtml(userName), userId, userId))
+	if err != nil {
+		logrus.Warn(err)
+	}
+	if access.Mode == config.AccessInvite {
+		return model.AccessPending, "The bot is invite only. Open your invite link, or wait for approval of the admin"
+	}
+	return model.AccessPending, "Your request is sent to the admin, please wait for approval"
+}
+
+// accessDenied returns reply for commands of not approved users
+func accessDenied(userId string, cmd string) string {
+	if contains(accessCommands, cmd) {
+		return ""
+	}
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return ""
+		}
+		logrus.Panic(err)
+	}
+	switch userInfo.Access {
+	case model.AccessPending:
+		return "Your user is waiting for approval of the admin"
+	case model.AccessDenied:
+		return "Access denied"
+	}
+	return ""
+}
+
+// feedLimit returns reply if the user cannot add more feeds by access config or user's plan
+func feedLimit(userInfo model.UserInfo) string {
+	max := maxFeeds(userInfo)
+	if upwork.NActiveFeeds(&userInfo) >= max {
+		return fmt.Sprintf("You have reached the limit of %d feeds, delete one with /del first or check /plan", max)
+	}
+	return ""
+}
+
+// wsFeedLimit is feedLimit of the workspace by the plan of its owners
+func wsFeedLimit(ws model.Workspace) string {
+	max := upwork.WorkspacePlan(ws).MaxFeeds
+	if access := config.GetAccess().MaxFeeds; access > 0 && access < max {
+		max = access
+	}
+	if upwork.NActive(ws.Feeds) >= max {
+		return fmt.Sprintf("The workspace has reached the limit of %d feeds of the owner's plan, delete one with /ws del first", max)
+	}
+	return ""
+}
+
+func maxFeeds(userInfo model.UserInfo) int {
+	max := plan.Of(userInfo).MaxFeeds
+	if access := config.GetAccess().MaxFeeds; access > 0 && access < max {
+		max = access
+	}
+	return max
+}
+
+func minPull(userInfo model.UserInfo) time.Duration {
+	min := plan.Of(userInfo).MinPull
+	if access := config.GetMinPull(); access > min {
+		min = access
+	}
+	return min
+}
+
+// pullCommand sets pull interval of the user: /pull 5m
+func pullCommand(userId string, args []string) string {
+	if len(args) != 1 {
+		return "Type /pull 5m"
+	}
+	pull, err := time.ParseDuration(args[0])
+	if err != nil || pull <= 0 {
+		return "incorrect interval"
+	}
+
+	userInfo := model.UserInfo{}
+	err = pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+	if min := minPull(userInfo); pull < min {
+		return fmt.Sprintf("Minimal pull interval is %s, check /plan", min)
+	}
+	userInfo.Pull = pull
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
+
+// accessCommand runs admin commands /pending, /approve ID, /deny ID and /invite [USES]
+func accessCommand(sender *Sender, cmd string, args []string) string {
+	switch {
+	case cmd == "/pending":
+		reply := ""
+		for _, userId := range allUsers() {
+			userInfo := model.UserInfo{}
+			err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+			if err != nil {
+				logrus.Panic(err)
+			}
+			if userInfo.Access == model.AccessPending {
+				reply += fmt.Sprintf("%s @%s /approve %s /deny %s<br/>", userId, escapeHtml(userInfo.UserName), userId, userId)
+			}
+		}
+		if reply == "" {
+			return "No pending users"
+		}
+		return reply
+	case (cmd == "/approve" || cmd == "/deny") && len(args) == 1:
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, args[0], &userInfo)
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				return "User is not found"
+			}
+			logrus.Panic(err)
+		}
+		userInfo.Access = model.AccessApproved
+		text := "Your access is approved. Type /start to subscribe the bot"
+		if cmd == "/deny" {
+			userInfo.Access = model.AccessDenied
+			userInfo.Active = false
+			text = "Your access is denied"
+		}
+		err = pudge.Set(model.DBPathUsers, args[0], userInfo)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		err = SendMsgToUser(sender, args[0], text)
+		if err != nil {
+			logrus.Warn(err)
+		}
+		return "ok"
+	case cmd == "/invite" && len(args) <= 1:
+		uses := 1
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return "Type /invite [USES]"
+			}
+			uses = n
+		}
+		code := accessInvitePrefix + randomHex(6)
+		err := pudge.Set(model.DBPathInvites, code, uses)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		return fmt.Sprintf("Invite link for %d users: https://t.me/%s?start=%s", uses, sender.Bot.Self.UserName, code)
+	}
+	return "Type /pending, /approve ID, /deny ID or /invite [USES]"
+}
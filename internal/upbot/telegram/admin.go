@@ -0,0 +1,270 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DataDir       = "data"
+	AdminMaxLines = 50
+)
+
+func isAdmin(userId string) bool {
+	return userId != "" && userId == config.GetAdmin()
+}
+
+// adminCommand runs /users, /user, /suspend, /broadcast, /health and /reload for the configured admin
+func adminCommand(sender *Sender, cmd string, text string, args []string, bt *bot.BotStruct) string {
+	switch cmd {
+	case "/users":
+		return usersList()
+	case "/user":
+		if len(args) != 1 {
+			return "Type /user ID"
+		}
+		return userDetails(args[0])
+	case "/suspend":
+		if len(args) == 0 || len(args) > 2 || len(args) == 2 && args[1] != "off" {
+			return "Type /suspend ID or /suspend ID off"
+		}
+		return suspendUser(args[0], len(args) == 1)
+	case "/broadcast":
+		body := strings.TrimSpace(strings.TrimPrefix(text, cmd))
+		if body == "" {
+			return "Type /broadcast TEXT"
+		}
+		users := activeUsers()
+		bt.Wg.Add(1)
+		go broadcast(sender, users, body, bt)
+		return fmt.Sprintf("Broadcasting to %d users", len(users))
+	case "/health":
+		return healthReport(bt)
+	case "/reload":
+		err := config.Reload()
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		return "Config is reloaded, telegram token and webhook are applied after restart"
+	}
+	return "Unknown command"
+}
+
+func allUsers() (result []string) {
+	keys, err := pudge.Keys(model.DBPathUsers, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	for _, key := range keys {
+		result = append(result, string(key))
+	}
+	return
+}
+
+func activeUsers() (result []string) {
+	for _, userId := range allUsers() {
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if userInfo.Active && !userInfo.Suspended {
+			result = append(result, userId)
+		}
+	}
+	return
+}
+
+func userState(userInfo model.UserInfo) string {
+	switch {
+	case userInfo.Suspended:
+		return "suspended"
+	case userInfo.Active:
+		return "active"
+	case userInfo.Blocked:
+		return "blocked"
+	}
+	return "stopped"
+}
+
+func usersList() string {
+	users := allUsers()
+	if len(users) == 0 {
+		return "No users"
+	}
+	reply := ""
+	for i, userId := range users {
+		if i == AdminMaxLines {
+			reply += fmt.Sprintf("... and %d more<br/>", len(users)-i)
+			break
+		}
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		reply += fmt.Sprintf("%s @%s %s feeds=%d/%d<br/>", userId, escapeHtml(userInfo.UserName), userState(userInfo),
+			upwork.NActiveFeeds(&userInfo), len(userInfo.Feeds))
+	}
+	return reply
+}
+
+func userDetails(userId string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "User is not found"
+		}
+		logrus.Panic(err)
+	}
+
+	reply := fmt.Sprintf("<b>%s</b> @%s %s<br/>chat=%d pull=%s layout=%s long=%s tz=%s<br/>",
+		userId, escapeHtml(userInfo.UserName), userState(userInfo), userInfo.ChannelID, userInfo.Pull,
+		userInfo.Layout, userInfo.LongMode, userInfo.Timezone)
+	reply += fmt.Sprintf("plan=%s expires=%s<br/>", plan.Of(userInfo).Name, userInfo.PlanExpires.Format("2006-01-02"))
+	reply += fmt.Sprintf("sinks=%d templates=%d keywords=%d clients=%d workspace=%s<br/>",
+		len(userInfo.Sinks), len(userInfo.Templates), len(userInfo.Keywords), len(userInfo.Clients), userInfo.Workspace)
+	for i, fd := range userInfo.Feeds {
+		url, err := secret.Decrypt(fd.Url)
+		if err != nil {
+			logrus.Error(err)
+		}
+		state := "off"
+		if fd.IsActive {
+			state = "on"
+		}
+		// the admin sees the feed without private tokens, so it is not a link
+		reply += fmt.Sprintf(`%d) %s %s %s`, i+1, state, escapeHtml(fd.Title), escapeHtml(secret.Redact(url)))
+		if fd.ChatID != 0 {
+			reply += " → " + escapeHtml(fd.ChatTitle)
+		}
+		reply += "<br/>"
+	}
+	for _, event := range userEvents(userId, UserEventsShown) {
+		reply += fmt.Sprintf("%s %s chat=%d %s<br/>", event.Time.Format(time.RFC3339), event.Kind, event.Chat, escapeHtml(event.Detail))
+	}
+	return reply
+}
+
+// suspendUser stops fetching for the user, the user cannot resume it by /start
+func suspendUser(userId string, suspend bool) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "User is not found"
+		}
+		logrus.Panic(err)
+	}
+	userInfo.Suspended = suspend
+	if suspend {
+		userInfo.Active = false
+	}
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	if suspend {
+		return "suspended"
+	}
+	return "suspension is lifted, the user can /start"
+}
+
+func broadcast(sender *Sender, users []string, text string, bt *bot.BotStruct) {
+	defer bt.Wg.Done()
+
+	sent := 0
+	for _, userId := range users {
+		select {
+		case <-bt.Ctx.Done():
+			return
+		default:
+		}
+		err := SendMsgToUser(sender, userId, text)
+		if err != nil {
+			logrus.WithField("user", userId).Warn(err)
+			continue
+		}
+		sent++
+	}
+	err := SendMsgToUser(sender, config.GetAdmin(), fmt.Sprintf("Broadcast is sent to %d of %d users", sent, len(users)))
+	if err != nil {
+		logrus.Warn(err)
+	}
+}
+
+func dbSize() (size int64) {
+	err := filepath.WalkDir(DataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		logrus.Warn(err)
+	}
+	return
+}
+
+func healthReport(bt *bot.BotStruct) string {
+	outbox, err := pudge.Count(model.DBPathOutbox)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	dead, err := pudge.Count(model.DBPathDead)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	reply := fmt.Sprintf("Queues: up2tel=%d admin=%d notice=%d outbox=%d dead=%d<br/>",
+		len(bt.Up2tel), len(bt.Admin), len(bt.Notice), outbox, dead)
+	reply += fmt.Sprintf("Jobs: delivered=%d retried=%d failed=%d skipped=%d, commands=%d<br/>",
+		bt.Metrics.Delivered.Load(), bt.Metrics.Retried.Load(), bt.Metrics.Failed.Load(),
+		bt.Metrics.Skipped.Load(), bt.Metrics.Commands.Load())
+	reply += fmt.Sprintf("DB size: %.1f MB<br/>", float64(dbSize())/(1<<20))
+
+	fetches, errs := 0, 0
+	feeds := upwork.Health()
+	for _, h := range feeds {
+		fetches += h.Fetches
+		errs += h.Errors
+	}
+	if fetches == 0 {
+		return reply + "No fetches yet"
+	}
+	reply += fmt.Sprintf("Feeds: %d fetches, %d errors (%.1f%%)<br/>", fetches, errs, 100*float64(errs)/float64(fetches))
+	for i, h := range feeds {
+		if i == 10 || h.Errors == 0 {
+			break
+		}
+		reply += fmt.Sprintf("%s %s: %d/%d errors, last %s: %s<br/>", h.User, escapeHtml(h.Feed), h.Errors, h.Fetches,
+			h.LastAt.Format(time.RFC3339), escapeHtml(h.LastErr))
+	}
+	return reply
+}
+
+// adminOnly replies to commands of the admin suite from other users
+func adminOnly(msg *tgbotapi.Message) string {
+	logrus.WithField("user", msg.From.ID).Warn("admin command: " + msg.Text)
+	return "Admin only"
+}
@@ -0,0 +1,112 @@
+package telegram
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+)
+
+const (
+	AlertSummary       = 10 * time.Minute
+	AlertClassInterval = time.Hour
+)
+
+const maxClassLength = 40
+
+var (
+	httpStatusRe = regexp.MustCompile(`http error: ([0-9]{3})`)
+	urlRe        = regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^\s"']+`)
+	numberRe     = regexp.MustCompile(`[0-9]+`)
+)
+
+// errorClass groups feed errors which have the same cause
+func errorClass(err string) string {
+	lower := strings.ToLower(err)
+	switch {
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(lower, "no such host"):
+		return "dns"
+	case strings.Contains(lower, "connection refused") || strings.Contains(lower, "connection reset") || strings.Contains(lower, "eof"):
+		return "connection"
+	case strings.Contains(lower, "detect feed type") || strings.Contains(lower, "xml"):
+		return "parse"
+	}
+	if m := httpStatusRe.FindStringSubmatch(lower); m != nil {
+		return "http " + m[1]
+	}
+	// other errors are grouped without urls and numbers which differ from feed to feed
+	class := urlRe.ReplaceAllString(lower, "URL")
+	class = numberRe.ReplaceAllString(class, "N")
+	if runes := []rune(class); len(runes) > maxClassLength {
+		return string(runes[:maxClassLength])
+	}
+	return class
+}
+
+// alerter sends the first error of each class at once, then summaries of the window,
+// and the recovery message when errors stop
+type alerter struct {
+	send    func(string)
+	window  []bot.Alert
+	sent    int // errors of the window sent at once
+	firing  bool
+	alerted map[string]time.Time
+	now     func() time.Time
+}
+
+func newAlerter(send func(string)) *alerter {
+	return &alerter{send: send, alerted: map[string]time.Time{}, now: time.Now}
+}
+
+func (a *alerter) add(alert bot.Alert) {
+	a.window = append(a.window, alert)
+	a.firing = true
+
+	class := errorClass(alert.Err)
+	if a.now().Sub(a.alerted[class]) < AlertClassInterval {
+		return
+	}
+	a.alerted[class] = a.now()
+	a.sent++
+	a.send(fmt.Sprintf("feed error (%s), user=%s feed=%s: %s<br/>Similar errors are aggregated",
+		escapeHtml(class), alert.User, escapeHtml(alert.Feed), escapeHtml(alert.Err)))
+}
+
+func (a *alerter) summary() {
+	if len(a.window) == 0 {
+		if a.firing {
+			a.firing = false
+			a.alerted = map[string]time.Time{}
+			a.send(fmt.Sprintf("✅ no feed errors in last %dm", int(AlertSummary.Minutes())))
+		}
+		return
+	}
+
+	if len(a.window) == a.sent {
+		a.window, a.sent = nil, 0
+		return
+	}
+
+	users := map[string]bool{}
+	classes := map[string]int{}
+	for _, alert := range a.window {
+		users[alert.User] = true
+		classes[errorClass(alert.Err)]++
+	}
+	top := make([]string, 0, len(classes))
+	for class := range classes {
+		top = append(top, class)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		return classes[top[i]] > classes[top[j]]
+	})
+
+	a.send(fmt.Sprintf("%d feed errors in last %dm, %d users affected, top error: %s (%d)",
+		len(a.window), int(AlertSummary.Minutes()), len(users), escapeHtml(top[0]), classes[top[0]]))
+	a.window, a.sent = nil, 0
+}
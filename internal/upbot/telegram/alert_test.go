@@ -0,0 +1,82 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err   string
+		class string
+	}{
+		{`Get "https://www.upwork.com/ab/feed/jobs/rss?q=go": context deadline exceeded`, "timeout"},
+		{"dial tcp: lookup www.upwork.com: no such host", "dns"},
+		{"read tcp 10.0.0.1:5123->1.2.3.4:443: connection reset by peer", "connection"},
+		{"Failed to detect feed type", "parse"},
+		{"http error: 403 Forbidden", "http 403"},
+		{"feed https://a.example/rss?id=1 has 12 items", "feed URL has N items"},
+		{"feed https://b.example/rss?id=2 has 7 items", "feed URL has N items"},
+	}
+	for _, tt := range tests {
+		if class := errorClass(tt.err); class != tt.class {
+			t.Errorf("%q: expected %q, got %q", tt.err, tt.class, class)
+		}
+	}
+
+	long := errorClass(strings.Repeat("ошибка ", 20))
+	if !utf8.ValidString(long) || utf8.RuneCountInString(long) != maxClassLength {
+		t.Errorf("class is not cut on rune boundary: %q", long)
+	}
+}
+
+func TestAlerter(t *testing.T) {
+	sent := []string{}
+	a := newAlerter(func(text string) { sent = append(sent, text) })
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	expect := func(n int, contains string) {
+		t.Helper()
+		if len(sent) != n {
+			t.Fatalf("expected %d messages, got %d: %q", n, len(sent), sent)
+		}
+		if contains != "" && !strings.Contains(sent[n-1], contains) {
+			t.Fatalf("expected %q in %q", contains, sent[n-1])
+		}
+	}
+
+	// the first error of the class is sent at once, the same class is aggregated
+	a.add(bot.Alert{User: "1", Feed: "go", Err: "http error: 500"})
+	expect(1, "feed error (http 500)")
+	a.add(bot.Alert{User: "2", Feed: "rust", Err: "http error: 500"})
+	a.add(bot.Alert{User: "2", Feed: "rust", Err: "http error: 500"})
+	expect(1, "")
+
+	a.summary()
+	expect(2, "3 feed errors in last 10m, 2 users affected, top error: http 500 (3)")
+
+	// the window of errors which were all sent at once has no summary
+	a.add(bot.Alert{User: "1", Feed: "go", Err: "no such host"})
+	expect(3, "feed error (dns)")
+	a.summary()
+	expect(3, "")
+
+	// the class is sent again after the interval
+	now = now.Add(AlertClassInterval)
+	a.add(bot.Alert{User: "1", Feed: "go", Err: "http error: 500"})
+	expect(4, "feed error (http 500)")
+	a.summary()
+
+	// recovery is sent once, and classes are sent at once after it
+	a.summary()
+	expect(5, "no feed errors")
+	a.summary()
+	expect(5, "")
+	a.add(bot.Alert{User: "1", Feed: "go", Err: "no such host"})
+	expect(6, "feed error (dns)")
+}
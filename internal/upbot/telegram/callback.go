@@ -0,0 +1,78 @@
+package telegram
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sirupsen/logrus"
+)
+
+// processCallback routes inline button presses by data prefix: "claim:take:ID"
+func processCallback(sender *Sender, cq *tgbotapi.CallbackQuery) {
+	logrus.Printf("[%s] callback %s", cq.From.UserName, cq.Data)
+
+	answer := ""
+	parts := strings.Split(cq.Data, ":")
+	switch {
+	case cq.Message == nil || len(parts) < 3:
+		answer = "Unknown button"
+	case parts[0] == "claim":
+		answer = claimCallback(sender, cq, parts[1], parts[2])
+	case parts[0] == "draft":
+		answer = draftCallback(sender, cq, parts[1], parts[2:])
+	case parts[0] == "save":
+		answer = saveCallback(sender, cq, parts[1], parts[2:])
+	case parts[0] == "client":
+		answer = clientCallback(cq, parts[1], parts[2])
+	default:
+		answer = "Unknown button"
+	}
+
+	_, err := sender.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, answer))
+	if err != nil {
+		logrus.Warn(err)
+	}
+}
+
+// jobKeyboard is buttons of job message, shared chats have claim buttons,
+// client buttons are shown if the feed has client signals
+func jobKeyboard(jobId string, clientId string, shared bool) *tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	if shared {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✋ I'll take it", "claim:take:"+jobId),
+			tgbotapi.NewInlineKeyboardButtonData("⏭ Skip", "claim:skip:"+jobId),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Applied", "claim:applied:"+jobId),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📝 Draft proposal", "draft:job:"+jobId),
+		tgbotapi.NewInlineKeyboardButtonData("⭐ Save", "save:add:"+jobId),
+		tgbotapi.NewInlineKeyboardButtonData("⏰ 2h", "save:remind:"+jobId),
+	))
+	if clientId != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👀 Follow client", "client:follow:"+jobId),
+			tgbotapi.NewInlineKeyboardButtonData("🚫 Bad client", "client:bad:"+jobId),
+		))
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+func userTitle(user *tgbotapi.User) string {
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	return user.FirstName
+}
+
+// editHtml replaces text and buttons of the sent message
+func editHtml(sender *Sender, msg *tgbotapi.Message, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
+	edit.ParseMode = tgbotapi.ModeHTML
+	edit.DisableWebPagePreview = true
+	edit.ReplyMarkup = markup
+	_, err := sender.Send(msg.Chat.ID, edit, PriorityHigh)
+	return err
+}
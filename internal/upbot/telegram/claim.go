@@ -0,0 +1,197 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+// sendClaimable sends job with claim buttons and keeps the text to edit it later
+func sendClaimable(sender *Sender, chat int64, job model.Job, text string, sent *int) error {
+	clientId, _ := upwork.ClientFingerprint(job)
+	claim := model.Claim{Chat: chat, JobID: model.JobID(job.GUID), ClientID: clientId, Title: job.Title, Link: job.Link}
+	last, err := sendHtmlParts(sender, chat, text, 0, PriorityLow, jobKeyboard(claim.JobID, clientId, true), sent)
+	if err != nil {
+		return err
+	}
+	claim.Text = last
+	claim.Updated = time.Now()
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	err = pudge.Set(model.DBPathClaims, claim.Key(), claim)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return nil
+}
+
+func claimStatus(claim model.Claim) string {
+	switch claim.State {
+	case model.ClaimTaken:
+		return "✋ taken by " + claim.UserName
+	case model.ClaimSkipped:
+		return "⏭ skipped by " + claim.UserName
+	case model.ClaimApplied:
+		return "✅ applied by " + claim.UserName
+	}
+	return ""
+}
+
+// canClaim returns true for members of the workspace which shares the chat, otherwise
+// for members of the group or admins of the channel, channel subscribers cannot claim
+func canClaim(sender *Sender, chat *tgbotapi.Chat, userId int) (bool, error) {
+	id := strconv.Itoa(userId)
+	for _, ws := range allWorkspaces() {
+		if ws.ChatID == chat.ID {
+			_, ok := ws.Members[id]
+			return ok, nil
+		}
+	}
+
+	member, err := sender.Bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: userId})
+	if err != nil {
+		return false, err
+	}
+	if chat.IsChannel() {
+		return member.IsCreator() || member.IsAdministrator(), nil
+	}
+	return member.IsCreator() || member.IsAdministrator() || member.IsMember(), nil
+}
+
+// claimsMu serializes changes of claims, members of the chat press buttons in different workers
+var claimsMu sync.Mutex
+
+// setClaim changes the state of the claim by the button, reply is not empty if it is not changed
+func setClaim(cq *tgbotapi.CallbackQuery, action string, jobId string) (model.Claim, string) {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+
+	key := model.Claim{Chat: cq.Message.Chat.ID, JobID: jobId}.Key()
+	claim := model.Claim{}
+	err := pudge.Get(model.DBPathClaims, key, &claim)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return claim, "Job is not found"
+		}
+		logrus.Panic(err)
+	}
+
+	userId := strconv.Itoa(cq.From.ID)
+	byOther := claim.User != "" && claim.User != userId &&
+		(claim.State == model.ClaimTaken || claim.State == model.ClaimApplied)
+	if byOther {
+		return claim, "Already " + claimStatus(claim)
+	}
+
+	switch action {
+	case "take":
+		claim.State = model.ClaimTaken
+	case "skip":
+		if claim.State == model.ClaimTaken {
+			// the member releases the job
+			claim.State = model.ClaimNone
+		} else {
+			claim.State = model.ClaimSkipped
+		}
+	case "applied":
+		claim.State = model.ClaimApplied
+	default:
+		return claim, "Unknown button"
+	}
+	claim.User = userId
+	claim.UserName = userTitle(cq.From)
+	if claim.State == model.ClaimNone {
+		claim.User = ""
+		claim.UserName = ""
+	}
+	claim.Updated = time.Now()
+
+	err = pudge.Set(model.DBPathClaims, key, claim)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return claim, ""
+}
+
+func claimCallback(sender *Sender, cq *tgbotapi.CallbackQuery, action string, jobId string) string {
+	allowed, err := canClaim(sender, cq.Message.Chat, cq.From.ID)
+	if err != nil {
+		logrus.Warn(err)
+		return "Cannot check chat members"
+	}
+	if !allowed {
+		return "Only members can claim jobs here"
+	}
+
+	claim, reply := setClaim(cq, action, jobId)
+	if reply != "" {
+		return reply
+	}
+
+	text := claim.Text
+	if status := claimStatus(claim); status != "" {
+		text += "\n\n<b>" + escapeHtml(status) + "</b>"
+	}
+	// applied job cannot be claimed anymore
+	markup := jobKeyboard(jobId, claim.ClientID, claim.State != model.ClaimApplied)
+	err = editHtml(sender, cq.Message, text, markup)
+	if err != nil {
+		logrus.Warn(err)
+	}
+
+	if claim.State == model.ClaimNone {
+		return "Released"
+	}
+	return claimStatus(claim)
+}
+
+// claimedList lists taken and applied jobs of the chat, or of the user in all chats
+func claimedList(chat int64, userId string) string {
+	var from interface{}
+	if chat != 0 {
+		from = strconv.FormatInt(chat, 10) + ";*"
+	}
+	keys, err := pudge.Keys(model.DBPathClaims, from, 0, 0, true)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+
+	claims := []model.Claim{}
+	for _, key := range keys {
+		claim := model.Claim{}
+		err := pudge.Get(model.DBPathClaims, key, &claim)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if claim.State != model.ClaimTaken && claim.State != model.ClaimApplied {
+			continue
+		}
+		if userId != "" && claim.User != userId {
+			continue
+		}
+		claims = append(claims, claim)
+	}
+	if len(claims) == 0 {
+		return "Empty"
+	}
+
+	sort.Slice(claims, func(i, j int) bool {
+		return claims[i].Updated.After(claims[j].Updated)
+	})
+
+	reply := ""
+	for i, claim := range claims {
+		reply += fmt.Sprintf(`%d) <a href="%s">%s</a> - %s<br/>`, i+1, format.EscapeAttr(claim.Link), escapeHtml(claim.Title), escapeHtml(claimStatus(claim)))
+	}
+	return reply
+}
@@ -0,0 +1,121 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+// clientFlag is the first line of job message from followed or bad client
+func clientFlag(userInfo model.UserInfo, clientId string) string {
+	if clientId == "" {
+		return ""
+	}
+	for _, mark := range userInfo.Clients {
+		if mark.ID != clientId {
+			continue
+		}
+		if mark.Bad {
+			return "⚠️ <b>Client is marked as bad</b>\n"
+		}
+		return "👀 <b>Followed client</b>\n"
+	}
+	return ""
+}
+
+// clientCallback handles "client:follow:ID" and "client:bad:ID" of the job
+func clientCallback(cq *tgbotapi.CallbackQuery, action string, jobId string) string {
+	if action != "follow" && action != "bad" {
+		return "Unknown button"
+	}
+	userId := strconv.Itoa(cq.From.ID)
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start in private chat with the bot first"
+		}
+		logrus.Panic(err)
+	}
+
+	content, err := upwork.LoadContent(jobId)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Job is not found"
+		}
+		logrus.Panic(err)
+	}
+	clientId, label := upwork.ClientFingerprint(content.Job)
+	if clientId == "" {
+		return "The feed has too few client details to tell the client apart"
+	}
+
+	mark := model.ClientMark{ID: clientId, Label: label, Bad: action == "bad", Added: time.Now()}
+	clients := []model.ClientMark{}
+	for _, v := range userInfo.Clients {
+		if v.ID != clientId {
+			clients = append(clients, v)
+		}
+	}
+	userInfo.Clients = append(clients, mark)
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	upwork.SetFollower(clientId, userId, !mark.Bad)
+
+	if mark.Bad {
+		return "Jobs of " + label + " will be flagged"
+	}
+	return "You follow " + label
+}
+
+// clientsCommand lists followed and bad clients: /clients, /clients del N
+func clientsCommand(userId string, args []string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	switch {
+	case len(args) == 0:
+		if len(userInfo.Clients) == 0 {
+			return "No clients. Use buttons of job messages to follow or flag clients"
+		}
+		reply := ""
+		for i, mark := range userInfo.Clients {
+			kind := "👀 follow"
+			if mark.Bad {
+				kind = "🚫 bad"
+			}
+			reply += fmt.Sprintf("%d) %s %s<br/>", i+1, kind, escapeHtml(mark.Label))
+		}
+		return reply + "<br/>/clients del N - forget the client"
+	case len(args) == 2 && args[0] == "del":
+		idx, err := strconv.Atoi(args[1])
+		if err != nil || idx < 1 || idx > len(userInfo.Clients) {
+			return "incorrect client number"
+		}
+		upwork.SetFollower(userInfo.Clients[idx-1].ID, userId, false)
+		userInfo.Clients = append(userInfo.Clients[:idx-1], userInfo.Clients[idx:]...)
+	default:
+		return "Type /clients or /clients del N"
+	}
+
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
@@ -0,0 +1,180 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+var tplAddRe = regexp.MustCompile(`^/tpl\s+add\s+(\S+)\s+([\s\S]+)$`)
+
+const tplUsage = "Type /tpl add NAME TEXT, /tpl show N, /tpl del N or /tpl to list.<br/>" +
+	"Placeholders: {title}, {country}, {skills}, {category}, {rate}, {link}"
+
+// fillTemplate replaces placeholders by the job fields
+func fillTemplate(text string, job model.Job) string {
+	return strings.NewReplacer(
+		"{title}", job.Title,
+		"{country}", job.Country,
+		"{skills}", strings.Join(job.Skills, ", "),
+		"{category}", job.Category,
+		"{rate}", format.Rate(job),
+		"{link}", job.Link,
+	).Replace(text)
+}
+
+func tplCommand(userId string, text string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	words := strings.Fields(text)
+	switch {
+	case len(words) == 1:
+		if len(userInfo.Templates) == 0 {
+			return "No templates.<br/>" + tplUsage
+		}
+		reply := ""
+		for i, tpl := range userInfo.Templates {
+			reply += fmt.Sprintf("%d) <b>%s</b> %s<br/>", i+1, escapeHtml(tpl.Name), escapeHtml(format.Shorten(50, tpl.Text)))
+		}
+		return reply
+	case len(words) > 3 && words[1] == "add":
+		m := tplAddRe.FindStringSubmatch(text)
+		if m == nil {
+			return tplUsage
+		}
+		userInfo.Templates = append(userInfo.Templates, model.Template{Name: m[1], Text: strings.TrimSpace(m[2])})
+	case len(words) == 3 && (words[1] == "show" || words[1] == "del"):
+		idx, err := strconv.Atoi(words[2])
+		if err != nil || idx < 1 || idx > len(userInfo.Templates) {
+			return "incorrect template number"
+		}
+		if words[1] == "show" {
+			tpl := userInfo.Templates[idx-1]
+			return "<b>" + escapeHtml(tpl.Name) + "</b><br/><pre>" + escapeHtml(tpl.Text) + "</pre>"
+		}
+		userInfo.Templates = append(userInfo.Templates[:idx-1], userInfo.Templates[idx:]...)
+	default:
+		return tplUsage
+	}
+
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
+
+// draftCallback starts proposal for the job in user's private chat: "draft:job:ID", "draft:tpl:ID:N", "draft:done:ID"
+func draftCallback(sender *Sender, cq *tgbotapi.CallbackQuery, action string, args []string) string {
+	userId := strconv.Itoa(cq.From.ID)
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start in private chat with the bot first"
+		}
+		logrus.Panic(err)
+	}
+
+	content, err := upwork.LoadContent(args[0])
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Job is not found"
+		}
+		logrus.Panic(err)
+	}
+
+	job := content.Job
+
+	switch {
+	case action == "job" && len(userInfo.Templates) == 0:
+		err = SendMsgToChannel(sender, userInfo.ChannelID, "No templates to draft a proposal.<br/>"+tplUsage, 0)
+	case action == "job" && len(userInfo.Templates) == 1:
+		err = startDraft(sender, userId, userInfo, job, 0)
+	case action == "job":
+		rows := [][]tgbotapi.InlineKeyboardButton{}
+		for i, tpl := range userInfo.Templates {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(tpl.Name, fmt.Sprintf("draft:tpl:%s:%d", args[0], i)),
+			))
+		}
+		text := "Choose template for <b>" + escapeHtml(job.Title) + "</b>"
+		_, err = sendHtmlMarkup(sender, userInfo.ChannelID, text, 0, PriorityHigh, tgbotapi.NewInlineKeyboardMarkup(rows...))
+	case action == "tpl" && len(args) == 2:
+		idx, convErr := strconv.Atoi(args[1])
+		if convErr != nil || idx < 0 || idx >= len(userInfo.Templates) {
+			return "Template is not found"
+		}
+		err = startDraft(sender, userId, userInfo, job, idx)
+	case action == "done":
+		if userInfo.WaitingFeedUrl != model.WaitingDraft || userInfo.Draft.JobID != args[0] {
+			return "Draft is finished already"
+		}
+		err = SendMsgToChannel(sender, userInfo.ChannelID, finishDraft(userId, userInfo.Draft.Text), 0)
+	default:
+		return "Unknown button"
+	}
+	if err != nil {
+		logrus.Warn(err)
+		return "Cannot send to your private chat"
+	}
+	return "Check private chat with the bot"
+}
+
+// startDraft fills the template and waits for the edited text
+func startDraft(sender *Sender, userId string, userInfo model.UserInfo, job model.Job, idx int) error {
+	draft := model.Draft{JobID: model.JobID(job.GUID), Text: fillTemplate(userInfo.Templates[idx].Text, job)}
+	userInfo.Draft = draft
+	userInfo.WaitingFeedUrl = model.WaitingDraft
+	err := pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	text := "Draft for <b>" + escapeHtml(job.Title) + "</b>:\n\n<pre>" + escapeHtml(draft.Text) + "</pre>\n\nSend edited text to finish"
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Use as is", "draft:done:"+draft.JobID),
+	))
+	_, err = sendHtmlMarkup(sender, userInfo.ChannelID, text, 0, PriorityHigh, markup)
+	return err
+}
+
+// finishDraft returns final proposal with apply link and resets waiting state
+func finishDraft(userId string, text string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	jobId := userInfo.Draft.JobID
+	userInfo.Draft = model.Draft{}
+	userInfo.WaitingFeedUrl = model.WaitingNone
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	reply := "<pre>" + escapeHtml(strings.TrimSpace(text)) + "</pre>"
+	content, err := upwork.LoadContent(jobId)
+	if err == nil {
+		job := content.Job
+		reply += fmt.Sprintf(`<br/><br/>Apply: <a href="%s">%s</a>`, format.EscapeAttr(upwork.ApplyLink(job.Link)), escapeHtml(job.Title))
+	}
+	return reply
+}
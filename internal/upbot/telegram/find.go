@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	FindDays    = upwork.SearchDays
+	FindResults = 20
+)
+
+var daysRe = regexp.MustCompile(`^([0-9]+)d$`)
+
+type found struct {
+	job       model.Job
+	processed time.Time
+}
+
+// receivedSince returns when the job was delivered to one of the owners, zero if it was not
+func receivedSince(owners []string, guid string, since time.Time) time.Time {
+	for _, owner := range owners {
+		val := model.JobValue{}
+		err := pudge.Get(model.DBPathJobs, model.JobInfoKey{User: owner, GUID: guid}.Key(), &val)
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				continue
+			}
+			logrus.Panic(err)
+		}
+		if val.Processed.After(since) {
+			return val.Processed
+		}
+	}
+	return time.Time{}
+}
+
+// findCommand searches jobs received by the user or user's workspaces: /find golang api 7d
+func findCommand(userId string, args []string) string {
+	days := FindDays
+	if len(args) > 0 {
+		if m := daysRe.FindStringSubmatch(args[len(args)-1]); m != nil {
+			days, _ = strconv.Atoi(m[1])
+			args = args[:len(args)-1]
+			// older jobs are not in the index
+			if days > FindDays {
+				days = FindDays
+			}
+		}
+	}
+	terms := upwork.Terms(strings.Join(args, " "))
+	if len(terms) == 0 {
+		return fmt.Sprintf("Type /find QUERY [Nd], jobs of the last %d days by default", FindDays)
+	}
+
+	owners := []string{userId}
+	for _, ws := range userWorkspaces(userId) {
+		owners = append(owners, ws.Key())
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	result := []found{}
+	for _, id := range upwork.Find(terms) {
+		content, err := upwork.LoadContent(id)
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				continue
+			}
+			logrus.Panic(err)
+		}
+		processed := receivedSince(owners, content.Job.GUID, since)
+		if processed.IsZero() {
+			continue
+		}
+		result = append(result, found{job: content.Job, processed: processed})
+	}
+	if len(result) == 0 {
+		return "Nothing found"
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].processed.After(result[j].processed)
+	})
+
+	reply := ""
+	for i, r := range result {
+		if i == FindResults {
+			reply += fmt.Sprintf("... and %d more<br/>", len(result)-i)
+			break
+		}
+		reply += fmt.Sprintf(`%d) %s <a href="%s">%s</a>`, i+1, r.processed.Format("Jan 2"), format.EscapeAttr(r.job.Link), escapeHtml(r.job.Title))
+		if rate := format.Rate(r.job); rate != "" {
+			reply += " " + rate
+		}
+		reply += "<br/>"
+	}
+	return reply
+}
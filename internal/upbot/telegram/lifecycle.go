@@ -0,0 +1,302 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EventBlocked     = "blocked"
+	EventUnblocked   = "unblocked"
+	EventDeactivated = "deactivated"
+	EventKicked      = "kicked"
+	EventMigrated    = "migrated"
+	UserEventsShown  = 5
+)
+
+// update adds my_chat_member which tgbotapi v4 does not know, or a task for the user's command worker
+type update struct {
+	tgbotapi.Update
+	MyChatMember *chatMemberUpdated `json:"my_chat_member"`
+
+	task func()
+}
+
+type chatMemberUpdated struct {
+	Chat          tgbotapi.Chat       `json:"chat"`
+	From          tgbotapi.User       `json:"from"`
+	Date          int                 `json:"date"`
+	OldChatMember tgbotapi.ChatMember `json:"old_chat_member"`
+	NewChatMember tgbotapi.ChatMember `json:"new_chat_member"`
+}
+
+// forbiddenEvents maps descriptions of sending errors (see tgDescription) to the events which stop delivery to the user
+var forbiddenEvents = map[string]string{
+	"Forbidden: bot was blocked by the user": EventBlocked,
+	"Forbidden: user is deactivated":         EventDeactivated,
+}
+
+func logEvent(userId string, kind string, chat int64, detail string) {
+	event := model.UserEvent{User: userId, Kind: kind, Chat: chat, Detail: detail, Time: time.Now()}
+	logrus.WithField("user", userId).WithField("chat", chat).WithField("detail", detail).Info("user event: " + kind)
+	err := pudge.Set(model.DBPathEvents, fmt.Sprintf("%s;%020d", userId, event.Time.UnixNano()), event)
+	if err != nil {
+		logrus.Panic(err)
+	}
+}
+
+// userEvents returns the last n events of the user
+func userEvents(userId string, n int) []model.UserEvent {
+	keys, err := pudge.Keys(model.DBPathEvents, userId+";*", 0, 0, true)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+	if len(keys) > n {
+		keys = keys[len(keys)-n:]
+	}
+	events := []model.UserEvent{}
+	for _, key := range keys {
+		event := model.UserEvent{}
+		err := pudge.Get(model.DBPathEvents, key, &event)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// blockUser stops delivery to the user who blocked the bot or was deleted
+func blockUser(userId string, kind string) {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return
+		}
+		logrus.Panic(err)
+	}
+	userInfo.Active = false
+	userInfo.Blocked = kind == EventBlocked
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	logEvent(userId, kind, userInfo.ChannelID, "")
+}
+
+// unblockUser resumes the user who was stopped by blocking the bot
+func unblockUser(userId string, bt *bot.BotStruct) {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return
+		}
+		logrus.Panic(err)
+	}
+	if !userInfo.Blocked {
+		logEvent(userId, EventUnblocked, userInfo.ChannelID, "was not active")
+		return
+	}
+	userInfo.Blocked = false
+	userInfo.Active = !userInfo.Suspended && userInfo.Access == model.AccessApproved
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	logEvent(userId, EventUnblocked, userInfo.ChannelID, "reactivated")
+
+	if userInfo.Active && upwork.HasActiveFeeds(&userInfo) {
+		upwork.StartFetch(userId, bt)
+	}
+}
+
+// processChatMember handles changes of the bot's membership: blocked or unblocked
+// in private chat, removed from group or channel
+func processChatMember(cm *chatMemberUpdated, bt *bot.BotStruct) {
+	userId := strconv.Itoa(cm.From.ID)
+	status := cm.NewChatMember.Status
+
+	if cm.Chat.IsPrivate() {
+		switch {
+		case status == "kicked":
+			blockUser(userId, EventBlocked)
+		case status == "member" && cm.OldChatMember.Status == "kicked":
+			unblockUser(userId, bt)
+		}
+		return
+	}
+
+	if status == "kicked" || status == "left" {
+		changes.add(chatChange{From: cm.Chat.ID, Title: chatTitle(cm.Chat)})
+	}
+}
+
+// chatChange is a group migrated to supergroup, or a chat which removed the bot if To is 0
+type chatChange struct {
+	From  int64
+	To    int64
+	Title string
+}
+
+// chatChanges is a queue which never blocks the workers adding to it
+type chatChanges struct {
+	mu    sync.Mutex
+	list  []chatChange
+	ready chan struct{}
+}
+
+var changes = &chatChanges{ready: make(chan struct{}, 1)}
+
+func (c *chatChanges) add(change chatChange) {
+	c.mu.Lock()
+	c.list = append(c.list, change)
+	c.mu.Unlock()
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (c *chatChanges) take() []chatChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := c.list
+	c.list = nil
+	return list
+}
+
+// chatWorker applies chat changes one by one. Records of users are rewritten by their command
+// workers, so the changes do not race with users' own commands
+func chatWorker(sender *Sender, bt *bot.BotStruct, q *queues, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-changes.ready:
+			for _, change := range changes.take() {
+				applyChatChange(sender, bt, q, change)
+			}
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
+
+func applyChatChange(sender *Sender, bt *bot.BotStruct, q *queues, change chatChange) {
+	for _, userId := range allUsers() {
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if !usesChat(userInfo, change.From) {
+			continue
+		}
+		userId := userId
+		if !q.runAs(bt, userId, func() { changeUserChat(sender, userId, change) }) {
+			return
+		}
+	}
+
+	// workspaces are not owned by one user, they are changed here
+	for _, ws := range allWorkspaces() {
+		if ws.ChatID != change.From {
+			continue
+		}
+		_, err := upwork.UpdateWorkspace(ws.ID, func(ws *model.Workspace) error {
+			if ws.ChatID != change.From {
+				return nil
+			}
+			ws.ChatID = change.To
+			if change.To == 0 {
+				ws.ChatTitle = ""
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.WithField("workspace", ws.ID).Warn(err)
+			continue
+		}
+		if change.To == 0 {
+			logEvent(ws.Key(), EventKicked, change.From, change.Title)
+		} else {
+			logEvent(ws.Key(), EventMigrated, change.To, fmt.Sprintf("%d -> %d", change.From, change.To))
+		}
+	}
+}
+
+func usesChat(userInfo model.UserInfo, chat int64) bool {
+	if userInfo.ChannelID == chat {
+		return true
+	}
+	for _, feed := range userInfo.Feeds {
+		if feed.ChatID == chat {
+			return true
+		}
+	}
+	return false
+}
+
+// changeUserChat moves the user's chat and routes to the supergroup, or back to the private chat
+// if the bot was removed
+func changeUserChat(sender *Sender, userId string, change chatChange) {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	if !usesChat(userInfo, change.From) {
+		return
+	}
+
+	if userInfo.ChannelID == change.From {
+		userInfo.ChannelID = change.To
+		if change.To == 0 {
+			// private chat id is the user id
+			userInfo.ChannelID, _ = strconv.ParseInt(userId, 10, 64)
+		}
+	}
+	for i := range userInfo.Feeds {
+		if userInfo.Feeds[i].ChatID == change.From {
+			userInfo.Feeds[i].ChatID = change.To
+			if change.To == 0 {
+				userInfo.Feeds[i].ChatTitle = ""
+			}
+		}
+	}
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	if change.To != 0 {
+		logEvent(userId, EventMigrated, change.To, fmt.Sprintf("%d -> %d", change.From, change.To))
+		return
+	}
+	logEvent(userId, EventKicked, change.From, change.Title)
+	err = SendMsgToUser(sender, userId, "The bot was removed from <b>"+escapeHtml(change.Title)+"</b>, jobs are sent here")
+	if err != nil {
+		logrus.WithField("user", userId).Warn(err)
+	}
+}
+
+// migratedTo returns the supergroup id if sending failed because the group was upgraded
+func migratedTo(err error) int64 {
+	var tgErr tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return tgErr.MigrateToChatID
+	}
+	return 0
+}
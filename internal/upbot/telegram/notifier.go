@@ -0,0 +1,235 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/notify"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const TelegramSinkID = "telegram"
+
+// TelegramNotifier sends to the user's chat, or to the feed's route, with user's layout settings
+type TelegramNotifier struct {
+	Sender   *Sender
+	UserInfo model.UserInfo
+	Chat     int64
+	// Parts counts parts of long message which are sent, the parts are skipped by the next try
+	Parts *int
+}
+
+func (n TelegramNotifier) chat() int64 {
+	if n.Chat != 0 {
+		return n.Chat
+	}
+	return n.UserInfo.ChannelID
+}
+
+func (n TelegramNotifier) SendJob(job model.Job) error {
+	layout := n.UserInfo.Layout
+	if layout == "" {
+		layout = config.GetLayout()
+	}
+	text, err := format.Render(layout, job)
+	if err != nil {
+		return err
+	}
+	if n.UserInfo.LongMode == format.LongTruncate {
+		text = format.Truncate(text, format.MaxLength, job.Link)
+	}
+
+	clientId, _ := upwork.ClientFingerprint(job)
+	text = clientFlag(n.UserInfo, clientId) + text
+
+	err = n.send(job, text, clientId)
+	// the group was upgraded to supergroup, routes follow it
+	if to := migratedTo(err); to != 0 {
+		changes.add(chatChange{From: n.chat(), To: to})
+		n.Chat = to
+		err = n.send(job, text, clientId)
+	}
+	return err
+}
+
+func (n TelegramNotifier) send(job model.Job, text string, clientId string) error {
+	// jobs in shared chats can be claimed by members
+	if n.chat() < 0 {
+		return sendClaimable(n.Sender, n.chat(), job, text, n.Parts)
+	}
+	_, err := sendHtmlParts(n.Sender, n.chat(), text, 0, PriorityLow, jobKeyboard(model.JobID(job.GUID), clientId, false), n.Parts)
+	return err
+}
+
+func (n TelegramNotifier) SendText(text string) error {
+	return SendMsgToChannel(n.Sender, n.chat(), text, 0)
+}
+
+func (n TelegramNotifier) Capabilities() notify.Capabilities {
+	return notify.Capabilities{Html: true, Buttons: true, MaxLength: format.MaxLength}
+}
+
+// userNotifiers returns telegram and all additional sinks of the user by sink id
+func userNotifiers(sender *Sender, userInfo model.UserInfo, chat int64) (ids []string, notifiers []notify.Notifier) {
+	ids = append(ids, TelegramSinkID)
+	notifiers = append(notifiers, TelegramNotifier{Sender: sender, UserInfo: userInfo, Chat: chat})
+
+	for _, sink := range userInfo.Sinks {
+		n, err := notify.New(sink)
+		if err != nil {
+			logrus.WithField("sink", sink.Kind).Error(err)
+			continue
+		}
+		ids = append(ids, sink.ID())
+		notifiers = append(notifiers, n)
+	}
+	return
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sendResumable sends the job, telegram continues long message from the part which is not sent yet
+func sendResumable(n notify.Notifier, sinkId string, job model.Job, parts map[string]int) error {
+	tn, ok := n.(TelegramNotifier)
+	if !ok {
+		return n.SendJob(job)
+	}
+	sent := parts[sinkId]
+	tn.Parts = &sent
+	err := tn.SendJob(job)
+	if err != nil && sent > 0 {
+		parts[sinkId] = sent
+	} else {
+		delete(parts, sinkId)
+	}
+	return err
+}
+
+// sendJob sends to every sink which is not in done list, and returns updated done list,
+// parts of long messages sent to sinks are kept in parts
+func sendJob(sender *Sender, user string, job model.Job, chat int64, done []string, parts map[string]int) ([]string, error) {
+	if upwork.IsWorkspaceKey(user) {
+		return sendWorkspaceJob(sender, user, job, done, parts)
+	}
+
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, user, &userInfo)
+	if err != nil {
+		return done, err
+	}
+
+	// one failed sink does not block others, the first error is returned to retry the rest
+	var firstErr error
+	ids, notifiers := userNotifiers(sender, userInfo, chat)
+	for i, n := range notifiers {
+		if contains(done, ids[i]) {
+			continue
+		}
+		err := sendResumable(n, ids[i], job, parts)
+		if err != nil {
+			logrus.WithField("user", user).WithField("sink", ids[i]).Warn(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		done = append(done, ids[i])
+	}
+	return done, firstErr
+}
+
+func sinkCommand(userId string, args []string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	usage := "Type /sink add slack|discord|webhook URL, /sink add email ADDRESS [digest], /sink del N or /sink to list"
+	switch {
+	case len(args) == 0:
+		if len(userInfo.Sinks) == 0 {
+			return "No additional destinations.<br/>" + usage
+		}
+		reply := ""
+		for i, sink := range userInfo.Sinks {
+			url, err := secret.Decrypt(sink.Url)
+			if err != nil {
+				logrus.Error(err)
+			}
+			reply += fmt.Sprintf("%d) %s %s %s<br/>", i+1, sink.Kind, escapeHtml(url), sink.Mode)
+		}
+		return reply
+	case (len(args) == 3 || len(args) == 4) && args[0] == "add":
+		if !notify.IsKind(args[1]) {
+			return usage
+		}
+		mode := ""
+		if len(args) == 4 {
+			if args[1] != notify.KindEmail || args[3] != notify.ModeDigest {
+				return usage
+			}
+			if !plan.Of(userInfo).Digest {
+				return "Email digest is not available on your plan, check /plan"
+			}
+			mode = notify.ModeDigest
+		}
+		if args[1] == notify.KindEmail {
+			addr, err := mail.ParseAddress(args[2])
+			if err != nil {
+				return "incorrect email address"
+			}
+			// only the address itself, without name or brackets
+			args[2] = addr.Address
+		} else if err := notify.ValidateUrl(args[1], args[2]); err != nil {
+			return escapeHtml(err.Error())
+		}
+		storedUrl, err := secret.Encrypt(args[2])
+		if err != nil {
+			logrus.Panic(err)
+		}
+		sink := model.SinkInfo{Kind: args[1], Url: storedUrl, Mode: mode}
+		n, err := notify.New(sink)
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		err = n.SendText("goupbot is connected")
+		if err != nil {
+			return "Cannot send test message: " + escapeHtml(err.Error())
+		}
+		userInfo.Sinks = append(userInfo.Sinks, sink)
+	case len(args) == 2 && args[0] == "del":
+		idx, err := strconv.Atoi(args[1])
+		if err != nil || idx < 1 || idx > len(userInfo.Sinks) {
+			return "incorrect index to delete"
+		}
+		userInfo.Sinks = append(userInfo.Sinks[:idx-1], userInfo.Sinks[idx:]...)
+	default:
+		return usage
+	}
+
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
@@ -0,0 +1,262 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/notify"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	MaxAttempts   = 8
+	RetryInterval = 30 * time.Second
+	MaxBackoff    = time.Hour
+	OutboxTick    = 10 * time.Second
+)
+
+type DeliveryResult int
+
+const (
+	Delivered DeliveryResult = iota
+	Retry
+	Failed
+)
+
+// tgDescription returns the description of telegram error. tgbotapi v4 drops the http code of the reply,
+// so telegram errors can be told apart by the text only: "Forbidden: ...", "Bad Gateway", etc
+func tgDescription(err error) (string, bool) {
+	var tgErr tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return tgErr.Message, true
+	}
+	return "", false
+}
+
+// isTransient returns true if sending may succeed later, and the delay telegram asked for.
+// Network errors, 5xx and 429 are transient, other errors go to the dead-letter list at once
+func isTransient(err error) (bool, time.Duration) {
+	var tgErr tgbotapi.Error
+	if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+		return true, time.Duration(tgErr.RetryAfter) * time.Second
+	}
+	if description, ok := tgDescription(err); ok {
+		for _, prefix := range []string{"Too Many Requests", "Internal Server Error", "Bad Gateway", "Service Unavailable", "Gateway Timeout"} {
+			if strings.HasPrefix(description, prefix) {
+				return true, 0
+			}
+		}
+		return false, 0
+	}
+
+	var statusErr notify.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Transient(), 0
+	}
+	// smtp 4xx replies are temporary failures
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code/100 == 4, 0
+	}
+	// non-json replies of telegram are html pages of proxies, e.g. 502
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return true, 0
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr), 0
+}
+
+func backoff(attempts int) time.Duration {
+	delay := RetryInterval << (attempts - 1)
+	if delay > MaxBackoff || delay <= 0 {
+		delay = MaxBackoff
+	}
+	return delay
+}
+
+// enqueue stores job in the outbox, NextTry leases it to the worker which is going to deliver it now,
+// the lease is kept by queues while the job is in flight
+func enqueue(job model.JobInfo) model.OutboxItem {
+	item := model.OutboxItem{Job: job, NextTry: time.Now().Add(RetryInterval)}
+	err := pudge.Set(model.DBPathOutbox, job.OutboxKey(), item)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return item
+}
+
+// markProcessed stores the job as processed, so it is not fetched again. Reminder keeps
+// the feed and time of the job for /stats and /find
+func markProcessed(up model.JobInfo) {
+	if up.Reminder {
+		return
+	}
+	logrus.WithField("key", up.Key).Debug("saving")
+	pubVal := model.JobValue{Published: *up.RSS.PublishedParsed, Processed: time.Now(), Feed: up.Feed}
+	err := pudge.Set(model.DBPathJobs, up.Key.Key(), pubVal)
+	if err != nil {
+		logrus.Panic(err)
+	}
+}
+
+// deliver sends the job and moves it to processed jobs, to retry later or to the dead-letter list
+func deliver(sender *Sender, item model.OutboxItem) DeliveryResult {
+	up := item.Job
+	key := up.OutboxKey()
+
+	if item.Parts == nil {
+		item.Parts = map[string]int{}
+	}
+	done, err := sendJob(sender, up.Key.User, upwork.ParseJob(&up.RSS), up.Chat, item.Done, item.Parts)
+	item.Done = done
+	if err == nil {
+		markProcessed(up)
+		err = pudge.Delete(model.DBPathOutbox, key)
+		if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+			logrus.Panic(err)
+		}
+		return Delivered
+	}
+
+	item.Attempts++
+	item.LastErr = err.Error()
+
+	description, _ := tgDescription(err)
+	if kind, ok := forbiddenEvents[description]; ok && !upwork.IsWorkspaceKey(up.Key.User) {
+		logrus.Error(err)
+		blockUser(up.Key.User, kind)
+	}
+
+	transient, retryAfter := isTransient(err)
+	if transient && item.Attempts < MaxAttempts {
+		if retryAfter == 0 {
+			retryAfter = backoff(item.Attempts)
+		}
+		item.NextTry = time.Now().Add(retryAfter)
+		logrus.WithField("key", up.Key).WithField("attempts", item.Attempts).Warnf("cannot send, retry in %s: %s", retryAfter, err)
+		err = pudge.Set(model.DBPathOutbox, key, item)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		return Retry
+	}
+
+	logrus.WithField("key", up.Key).Errorf("cannot send to user = %s: %T: %s", up.Key.User, err, err)
+	item.Failed = time.Now()
+	err = pudge.Set(model.DBPathDead, key, item)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	err = pudge.Delete(model.DBPathOutbox, key)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+	return Failed
+}
+
+// processOutbox dispatches all due jobs which are not in flight to delivery workers
+func processOutbox(bt *bot.BotStruct, q *queues) {
+	keys, err := pudge.Keys(model.DBPathOutbox, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		// the worker updates the item itself when delivery is done
+		if q.isInflight(string(key)) {
+			continue
+		}
+		item := model.OutboxItem{}
+		err := pudge.Get(model.DBPathOutbox, key, &item)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if item.NextTry.After(now) {
+			continue
+		}
+		item.NextTry = now.Add(RetryInterval)
+		err = pudge.Set(model.DBPathOutbox, key, item)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		q.dispatch(bt, item)
+	}
+}
+
+func deadList() (reply string) {
+	keys, err := pudge.Keys(model.DBPathDead, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	if len(keys) == 0 {
+		return "Dead-letter list is empty"
+	}
+
+	for i, key := range keys {
+		if i == 20 {
+			reply += fmt.Sprintf("... and %d more<br/>", len(keys)-i)
+			break
+		}
+		item := model.OutboxItem{}
+		err := pudge.Get(model.DBPathDead, key, &item)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		reply += fmt.Sprintf("%d) %s user=%s attempts=%d: %s<br/>",
+			i+1, item.Failed.Format(time.RFC3339), item.Job.Key.User, item.Attempts, escapeHtml(item.LastErr))
+	}
+	return reply + "<br/>/dead retry - requeue all, /dead clear - drop all"
+}
+
+// deadRetry moves all dead-letter jobs back to the outbox with their delivery state, or drops them
+// as processed, so they are not fetched again
+func deadRetry(requeue bool) string {
+	keys, err := pudge.Keys(model.DBPathDead, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	for _, key := range keys {
+		item := model.OutboxItem{}
+		err := pudge.Get(model.DBPathDead, key, &item)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if requeue {
+			// sinks which got the job are skipped by the next try
+			item.Attempts = 0
+			item.NextTry = time.Time{}
+			item.Failed = time.Time{}
+			err = pudge.Set(model.DBPathOutbox, key, item)
+			if err != nil {
+				logrus.Panic(err)
+			}
+		} else {
+			markProcessed(item.Job)
+		}
+		err = pudge.Delete(model.DBPathDead, key)
+		if err != nil {
+			logrus.Panic(err)
+		}
+	}
+
+	if requeue {
+		return fmt.Sprintf("%d jobs requeued", len(keys))
+	}
+	return fmt.Sprintf("%d jobs dropped", len(keys))
+}
@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func planInfo(userId string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	p := plan.Of(userInfo)
+	reply := "Your plan: <b>" + p.Name + "</b>"
+	if p.Name != plan.Free && !userInfo.PlanExpires.IsZero() {
+		reply += " until " + userInfo.PlanExpires.Format("2006-01-02")
+	}
+	reply += fmt.Sprintf("<br/>feeds: %d<br/>pull interval: %s<br/>search filters: %s<br/>email digest: %s<br/>",
+		maxFeeds(userInfo), minPull(userInfo), yesNo(p.Filters), yesNo(p.Digest))
+	return reply + "<br/>Plans: " + strings.Join(plan.Names, ", ") + ", contact the admin to upgrade"
+}
+
+// setPlan changes plan of the user for the admin: /plan ID pro 30
+func setPlan(args []string) string {
+	if len(args) < 2 || len(args) > 3 || !plan.IsPlan(args[1]) {
+		return "Type /plan ID " + strings.Join(plan.Names, "|") + " [DAYS]"
+	}
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, args[0], &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "User is not found"
+		}
+		logrus.Panic(err)
+	}
+
+	userInfo.Plan = args[1]
+	userInfo.PlanExpires = time.Time{}
+	if len(args) == 3 {
+		days, err := strconv.Atoi(args[2])
+		if err != nil || days <= 0 {
+			return "incorrect number of days"
+		}
+		userInfo.PlanExpires = time.Now().AddDate(0, 0, days)
+	}
+	err = pudge.Set(model.DBPathUsers, args[0], userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
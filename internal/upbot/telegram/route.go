@@ -0,0 +1,164 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+// commands which do not change settings and are allowed for any member of a group
+var readOnlyCommands = map[string]bool{
+	"/help":    true,
+	"/ping":    true,
+	"/list":    true,
+	"/where":   true,
+	"/claimed": true,
+	"/mine":    true,
+}
+
+func isGroup(chat *tgbotapi.Chat) bool {
+	return chat.IsGroup() || chat.IsSuperGroup()
+}
+
+func isChatAdmin(sender *Sender, chatId int64, userId int) (bool, error) {
+	member, err := sender.Bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatId, UserID: userId})
+	if err != nil {
+		return false, err
+	}
+	return member.IsCreator() || member.IsAdministrator(), nil
+}
+
+// groupCommand strips @botname from the command, returns false if the message
+// is not for the bot or the sender is not allowed to change settings in the group
+func groupCommand(sender *Sender, msg *tgbotapi.Message, cmd string) (string, bool, string) {
+	if idx := strings.Index(cmd, "@"); idx >= 0 {
+		if !strings.EqualFold(cmd[idx+1:], sender.Bot.Self.UserName) {
+			return cmd, false, ""
+		}
+		cmd = cmd[:idx]
+	}
+	if !isGroup(msg.Chat) {
+		return cmd, true, ""
+	}
+	// plain group chatter is not for the bot
+	if !strings.HasPrefix(cmd, "/") {
+		return cmd, false, ""
+	}
+	if readOnlyCommands[cmd] {
+		return cmd, true, ""
+	}
+	admin, err := isChatAdmin(sender, msg.Chat.ID, msg.From.ID)
+	if err != nil {
+		logrus.Error(err)
+		return cmd, false, "Cannot check chat admins"
+	}
+	if !admin {
+		return cmd, false, "Only chat admins can change settings"
+	}
+	return cmd, true, ""
+}
+
+// resolveChat finds chat by @username, id or "here", and checks the bot and the user are admins there
+func resolveChat(sender *Sender, arg string, current *tgbotapi.Chat, userId int) (tgbotapi.Chat, error) {
+	cfg := tgbotapi.ChatConfig{}
+	switch {
+	case arg == "here":
+		cfg.ChatID = current.ID
+	case strings.HasPrefix(arg, "@"):
+		cfg.SuperGroupUsername = arg
+	default:
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return tgbotapi.Chat{}, errors.New("chat expected: @channel, chat id or here")
+		}
+		cfg.ChatID = id
+	}
+
+	chat, err := sender.Bot.GetChat(cfg)
+	if err != nil {
+		return chat, fmt.Errorf("cannot find chat %s: %w", arg, err)
+	}
+	if chat.IsPrivate() {
+		return chat, errors.New("private chat cannot be a route")
+	}
+
+	member, err := sender.Bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: sender.Bot.Self.ID})
+	if err != nil {
+		return chat, err
+	}
+	if !member.IsAdministrator() && !member.IsCreator() {
+		return chat, errors.New("make the bot an admin of the chat first")
+	}
+	if chat.IsChannel() && !member.CanPostMessages {
+		return chat, errors.New("the bot cannot post messages to the channel")
+	}
+
+	admin, err := isChatAdmin(sender, chat.ID, userId)
+	if err != nil {
+		return chat, err
+	}
+	if !admin {
+		return chat, errors.New("only chat admins can route feeds to the chat")
+	}
+
+	return chat, nil
+}
+
+func chatTitle(chat tgbotapi.Chat) string {
+	if chat.UserName != "" {
+		return "@" + chat.UserName
+	}
+	if chat.Title != "" {
+		return chat.Title
+	}
+	return strconv.FormatInt(chat.ID, 10)
+}
+
+// routeCommand sends jobs of the feed to a group or channel: /route <feed> <chat>|off
+func routeCommand(sender *Sender, msg *tgbotapi.Message, userId string, args []string) string {
+	if len(args) != 2 {
+		return "Type /route FEED_NUMBER @channel|chat_id|here|off"
+	}
+
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	idx, err := strconv.Atoi(args[0])
+	if err != nil || idx < 1 || idx > len(userInfo.Feeds) {
+		return "incorrect feed number, check with /list"
+	}
+	feed := &userInfo.Feeds[idx-1]
+
+	reply := ""
+	if args[1] == "off" {
+		feed.ChatID = 0
+		feed.ChatTitle = ""
+		reply = fmt.Sprintf("<b>%s</b> is routed to your chat", escapeHtml(feed.Title))
+	} else {
+		chat, err := resolveChat(sender, args[1], msg.Chat, msg.From.ID)
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		feed.ChatID = chat.ID
+		feed.ChatTitle = chatTitle(chat)
+		reply = fmt.Sprintf("<b>%s</b> is routed to %s", escapeHtml(feed.Title), escapeHtml(feed.ChatTitle))
+	}
+
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return reply
+}
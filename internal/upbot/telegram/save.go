@@ -0,0 +1,238 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SavedPageSize = 5
+	RemindDelay   = 2 * time.Hour
+)
+
+// parseDelay is time.ParseDuration with days: 2h, 30m, 1d
+func parseDelay(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n <= 0 {
+			return 0, errors.New("incorrect delay")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New("incorrect delay")
+	}
+	return d, nil
+}
+
+// saveJob adds the job to user's saved list, remind is ignored if 0
+func saveJob(userId string, jobId string, remind time.Duration) (model.SavedJob, error) {
+	saved := model.SavedJob{}
+	err := pudge.Get(model.DBPathSaved, userId+";"+jobId, &saved)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+	if err != nil {
+		content, err := upwork.LoadContent(jobId)
+		if err != nil {
+			return saved, err
+		}
+		saved = model.SavedJob{User: userId, RSS: content.RSS, Saved: time.Now()}
+	}
+	if remind > 0 {
+		saved.RemindAt = time.Now().Add(remind)
+	}
+	err = pudge.Set(model.DBPathSaved, saved.Key(), saved)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return saved, nil
+}
+
+func savedJobs(userId string) []model.SavedJob {
+	keys, err := pudge.Keys(model.DBPathSaved, userId+";*", 0, 0, true)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+
+	list := []model.SavedJob{}
+	for _, key := range keys {
+		saved := model.SavedJob{}
+		err := pudge.Get(model.DBPathSaved, key, &saved)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		list = append(list, saved)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Saved.After(list[j].Saved)
+	})
+	return list
+}
+
+// savedPage renders one page of saved jobs with remove and navigation buttons
+func savedPage(userId string, page int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	list := savedJobs(userId)
+	if len(list) == 0 {
+		return "No saved jobs", nil
+	}
+	pages := (len(list) + SavedPageSize - 1) / SavedPageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	text := fmt.Sprintf("<b>Saved jobs</b> %d/%d\n\n", page+1, pages)
+	buttons := []tgbotapi.InlineKeyboardButton{}
+	for i := page * SavedPageSize; i < len(list) && i < (page+1)*SavedPageSize; i++ {
+		job := upwork.ParseJob(&list[i].RSS)
+		text += fmt.Sprintf(`%d) <a href="%s">%s</a>`, i+1, format.EscapeAttr(job.Link), escapeHtml(job.Title))
+		if rate := format.Rate(job); rate != "" {
+			text += " " + rate
+		}
+		if !list[i].RemindAt.IsZero() {
+			text += " ⏰ " + list[i].RemindAt.Format("Jan 2 15:04")
+		}
+		text += "\n"
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("❌ %d", i+1), fmt.Sprintf("save:del:%s:%d", model.JobID(job.GUID), page)))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{buttons}
+	nav := []tgbotapi.InlineKeyboardButton{}
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("« Prev", fmt.Sprintf("save:page:%d", page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("Next »", fmt.Sprintf("save:page:%d", page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text, &markup
+}
+
+func savedCommand(sender *Sender, msg *tgbotapi.Message, userId string) string {
+	text, markup := savedPage(userId, 0)
+	if markup == nil {
+		return text
+	}
+	_, err := sendHtmlMarkup(sender, msg.Chat.ID, text, 0, PriorityHigh, markup)
+	if err != nil {
+		logrus.Warn(err)
+	}
+	return ""
+}
+
+// remindCommand sets reminder for saved job: /remind N 2h
+func remindCommand(userId string, args []string) string {
+	if len(args) != 2 {
+		return "Type /remind N 2h, where N is number from /saved"
+	}
+	list := savedJobs(userId)
+	idx, err := strconv.Atoi(args[0])
+	if err != nil || idx < 1 || idx > len(list) {
+		return "incorrect saved job number"
+	}
+	delay, err := parseDelay(args[1])
+	if err != nil {
+		return escapeHtml(err.Error())
+	}
+	saved := list[idx-1]
+	saved.RemindAt = time.Now().Add(delay)
+	err = pudge.Set(model.DBPathSaved, saved.Key(), saved)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "I will remind at " + saved.RemindAt.Format("Jan 2 15:04")
+}
+
+// saveCallback handles "save:add:ID", "save:remind:ID", "save:del:ID:PAGE" and "save:page:PAGE"
+func saveCallback(sender *Sender, cq *tgbotapi.CallbackQuery, action string, args []string) string {
+	userId := strconv.Itoa(cq.From.ID)
+
+	switch action {
+	case "add", "remind":
+		delay := time.Duration(0)
+		if action == "remind" {
+			delay = RemindDelay
+		}
+		saved, err := saveJob(userId, args[0], delay)
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				return "Job is not found"
+			}
+			logrus.Panic(err)
+		}
+		if action == "remind" {
+			return "I will remind at " + saved.RemindAt.Format("Jan 2 15:04")
+		}
+		return "Saved, see /saved"
+	case "del", "page":
+		page := 0
+		if action == "del" {
+			err := pudge.Delete(model.DBPathSaved, userId+";"+args[0])
+			if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+				logrus.Panic(err)
+			}
+			if len(args) == 2 {
+				page, _ = strconv.Atoi(args[1])
+			}
+		} else {
+			page, _ = strconv.Atoi(args[0])
+		}
+		text, markup := savedPage(userId, page)
+		err := editHtml(sender, cq.Message, text, markup)
+		if err != nil {
+			logrus.Warn(err)
+		}
+		if action == "del" {
+			return "Removed"
+		}
+		return ""
+	}
+	return "Unknown button"
+}
+
+// processReminders sends due saved jobs again through the outbox
+func processReminders(bt *bot.BotStruct, q *queues) {
+	keys, err := pudge.Keys(model.DBPathSaved, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		saved := model.SavedJob{}
+		err := pudge.Get(model.DBPathSaved, key, &saved)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if saved.RemindAt.IsZero() || saved.RemindAt.After(now) {
+			continue
+		}
+		saved.RemindAt = time.Time{}
+		err = pudge.Set(model.DBPathSaved, key, saved)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		job := model.JobInfo{Key: model.JobInfoKey{User: saved.User, GUID: saved.RSS.GUID}, RSS: saved.RSS, Reminder: true}
+		q.dispatch(bt, enqueue(job))
+	}
+}
@@ -0,0 +1,191 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sirupsen/logrus"
+)
+
+type Priority int
+
+const (
+	PriorityHigh Priority = iota // command replies
+	PriorityLow                  // bulk job notifications
+)
+
+const (
+	GlobalRate     = 30 // messages per second
+	PrivatePace    = time.Second
+	GroupPace      = 3 * time.Second
+	MaxRetryAfter  = 3
+	senderQueueLen = 100
+)
+
+var ErrSenderStopped = errors.New("sender is stopped")
+
+type sendResult struct {
+	msg tgbotapi.Message
+	err error
+}
+
+type sendReq struct {
+	chat    int64
+	c       tgbotapi.Chattable
+	prio    Priority
+	retries int
+	result  chan sendResult
+}
+
+// Sender schedules all outgoing telegram requests: global token bucket,
+// per-chat pacing and priority of command replies over job notifications
+type Sender struct {
+	Bot      *tgbotapi.BotAPI
+	requests chan *sendReq
+	done     chan struct{}
+	queues   [PriorityLow + 1][]*sendReq
+	chatNext map[int64]time.Time
+	tokens   float64
+	last     time.Time
+	paused   time.Time // flood limit of the bot, nothing is sent until it
+}
+
+func NewSender(bot *tgbotapi.BotAPI) *Sender {
+	return &Sender{
+		Bot:      bot,
+		requests: make(chan *sendReq, senderQueueLen),
+		done:     make(chan struct{}),
+		chatNext: map[int64]time.Time{},
+		tokens:   GlobalRate,
+		last:     time.Now(),
+	}
+}
+
+// Send blocks until the request is sent by the scheduler
+func (s *Sender) Send(chat int64, c tgbotapi.Chattable, prio Priority) (tgbotapi.Message, error) {
+	req := &sendReq{chat: chat, c: c, prio: prio, result: make(chan sendResult, 1)}
+	select {
+	case s.requests <- req:
+	case <-s.done:
+		return tgbotapi.Message{}, ErrSenderStopped
+	}
+	select {
+	case res := <-req.result:
+		return res.msg, res.err
+	case <-s.done:
+		return tgbotapi.Message{}, ErrSenderStopped
+	}
+}
+
+func pace(chat int64) time.Duration {
+	if chat < 0 {
+		return GroupPace
+	}
+	return PrivatePace
+}
+
+func (s *Sender) refill(now time.Time) {
+	s.tokens += now.Sub(s.last).Seconds() * GlobalRate
+	if s.tokens > GlobalRate {
+		s.tokens = GlobalRate
+	}
+	s.last = now
+}
+
+// next returns first request which chat is ready, or time when some chat will be ready
+func (s *Sender) next(now time.Time) (*sendReq, time.Time) {
+	wake := time.Time{}
+	for prio := range s.queues {
+		for i, req := range s.queues[prio] {
+			ready := s.chatNext[req.chat]
+			if !ready.After(now) {
+				s.queues[prio] = append(s.queues[prio][:i], s.queues[prio][i+1:]...)
+				return req, now
+			}
+			if wake.IsZero() || ready.Before(wake) {
+				wake = ready
+			}
+		}
+	}
+	return nil, wake
+}
+
+func (s *Sender) push(req *sendReq, front bool) {
+	if front {
+		s.queues[req.prio] = append([]*sendReq{req}, s.queues[req.prio]...)
+	} else {
+		s.queues[req.prio] = append(s.queues[req.prio], req)
+	}
+}
+
+func (s *Sender) Run(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		now := time.Now()
+		s.refill(now)
+
+	drain:
+		for {
+			select {
+			case r := <-s.requests:
+				s.push(r, false)
+			default:
+				break drain
+			}
+		}
+
+		var req *sendReq
+		wake := now
+		if s.paused.After(now) {
+			wake = s.paused
+		} else if s.tokens < 1 {
+			wake = now.Add(time.Duration((1 - s.tokens) / GlobalRate * float64(time.Second)))
+		} else {
+			req, wake = s.next(now)
+		}
+
+		if req == nil {
+			var timer <-chan time.Time
+			if !wake.IsZero() {
+				timer = time.After(time.Until(wake))
+			}
+			select {
+			case r := <-s.requests:
+				s.push(r, false)
+			case <-timer:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if len(s.chatNext) > senderQueueLen*10 {
+			for chat, ready := range s.chatNext {
+				if ready.Before(now) {
+					delete(s.chatNext, chat)
+				}
+			}
+		}
+
+		s.tokens--
+		s.chatNext[req.chat] = now.Add(pace(req.chat))
+		msg, err := s.Bot.Send(req.c)
+
+		var tgErr tgbotapi.Error
+		if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 && req.retries < MaxRetryAfter {
+			retryAfter := time.Duration(tgErr.RetryAfter) * time.Second
+			logrus.WithField("chat", req.chat).Warnf("flood limit, retry after %s", retryAfter)
+			req.retries++
+			s.chatNext[req.chat] = now.Add(retryAfter)
+			// the limit is of the whole bot, other chats wait too
+			s.paused = now.Add(retryAfter)
+			s.push(req, true)
+			continue
+		}
+
+		req.result <- sendResult{msg: msg, err: err}
+	}
+}
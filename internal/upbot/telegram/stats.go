@@ -0,0 +1,213 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const StatsTop = 5
+
+type feedStats struct {
+	today, week, month int
+}
+
+type counter map[string]int
+
+// top returns n most frequent keys as "key (count)"
+func (c counter) top(n int) string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c[keys[i]] != c[keys[j]] {
+			return c[keys[i]] > c[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s (%d)", k, c[k])
+	}
+	return strings.Join(keys, ", ")
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+func userLocation(userInfo model.UserInfo) *time.Location {
+	if userInfo.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(userInfo.Timezone)
+	if err != nil {
+		logrus.Warn(err)
+		return time.UTC
+	}
+	return loc
+}
+
+// tzCommand sets timezone of the user: /tz Europe/Berlin
+func tzCommand(userId string, args []string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+	if len(args) != 1 {
+		return "Your timezone is " + userLocation(userInfo).String() + ". Type /tz Europe/Berlin to change"
+	}
+	if _, err := time.LoadLocation(args[0]); err != nil {
+		return "Unknown timezone"
+	}
+	userInfo.Timezone = args[0]
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
+
+// statsCommand reports jobs delivered to the user during the last month
+func statsCommand(userId string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	loc := userLocation(userInfo)
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	week := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	// the week can start in the previous month
+	from := month
+	if week.Before(month) {
+		from = week
+	}
+
+	keys, err := pudge.Keys(model.DBPathJobs, userId+";*", 0, 0, true)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+
+	feeds := map[string]*feedStats{}
+	skills, countries, hours := counter{}, counter{}, counter{}
+	budgets, rates := []float64{}, []float64{}
+	for _, key := range keys {
+		val := model.JobValue{}
+		err := pudge.Get(model.DBPathJobs, key, &val)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		// drained jobs are not delivered
+		if val.Processed.Before(from) {
+			continue
+		}
+
+		name := val.Feed
+		if name == "" {
+			name = "other"
+		}
+		fs := feeds[name]
+		if fs == nil {
+			fs = &feedStats{}
+			feeds[name] = fs
+		}
+		if !val.Processed.Before(week) {
+			fs.week++
+		}
+		if !val.Processed.Before(today) {
+			fs.today++
+		}
+		// the rest is stats of the month
+		if val.Processed.Before(month) {
+			continue
+		}
+		fs.month++
+		hours[val.Published.In(loc).Format("15:00")]++
+
+		guid := strings.TrimPrefix(string(key), userId+";")
+		content, err := upwork.LoadContent(model.JobID(guid))
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				continue
+			}
+			logrus.Panic(err)
+		}
+		job := content.Job
+		if job.Budget > 0 {
+			budgets = append(budgets, job.Budget)
+		}
+		if job.HourlyMin > 0 {
+			rates = append(rates, (job.HourlyMin+job.HourlyMax)/2)
+		}
+		for _, skill := range job.Skills {
+			skills[skill]++
+		}
+		if job.Country != "" {
+			countries[job.Country]++
+		}
+	}
+	if len(feeds) == 0 {
+		return "No jobs this month"
+	}
+
+	names := make([]string, 0, len(feeds))
+	width := len("feed")
+	for name := range feeds {
+		names = append(names, name)
+		if n := len([]rune(name)); n > width {
+			width = n
+		}
+	}
+	sort.Strings(names)
+
+	table := fmt.Sprintf("%-*s %5s %5s %5s\n", width, "feed", "today", "week", "month")
+	for _, name := range names {
+		fs := feeds[name]
+		table += fmt.Sprintf("%-*s %5d %5d %5d\n", width, name, fs.today, fs.week, fs.month)
+	}
+
+	reply := "<pre>" + escapeHtml(table) + "</pre><br/>"
+	if len(budgets) > 0 {
+		reply += fmt.Sprintf("Median budget: $%.0f<br/>", median(budgets))
+	}
+	if len(rates) > 0 {
+		reply += fmt.Sprintf("Median hourly: $%.0f<br/>", median(rates))
+	}
+	if len(skills) > 0 {
+		reply += "Top skills: " + escapeHtml(skills.top(StatsTop)) + "<br/>"
+	}
+	if len(countries) > 0 {
+		reply += "Top countries: " + escapeHtml(countries.top(StatsTop)) + "<br/>"
+	}
+	reply += "Busiest hours (" + loc.String() + "): " + hours.top(3)
+	return reply
+}
@@ -1,17 +1,22 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/inv2004/goupbot/internal/upbot/bot"
 	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/inv2004/goupbot/internal/upbot/format"
 	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
 	"github.com/inv2004/goupbot/internal/upbot/upwork"
 	"github.com/recoilme/pudge"
 	"github.com/sirupsen/logrus"
@@ -52,20 +57,20 @@ func setActive(userId string, active bool) string {
 	}
 }
 
-func sendWhere(bot *tgbotapi.BotAPI, channel int64, replyTo int) (err error) {
+func sendWhere(sender *Sender, channel int64, replyTo int) (err error) {
 	pic := tgbotapi.NewPhotoUpload(channel, imgUrl)
 
 	if replyTo > 0 {
 		pic.ReplyToMessageID = replyTo
 	}
 
-	_, err = bot.Send(pic)
+	_, err = sender.Send(channel, pic, PriorityHigh)
 	if err != nil {
 		return err
 	}
 
 	msg := tgbotapi.NewMessage(channel, "paste rss url to add here:")
-	_, err = bot.Send(msg)
+	_, err = sender.Send(channel, msg, PriorityHigh)
 	if err != nil {
 		return err
 	}
@@ -74,45 +79,68 @@ func sendWhere(bot *tgbotapi.BotAPI, channel int64, replyTo int) (err error) {
 }
 
 func escapeHtml(s string) (result string) {
-	result = s
+	result = secret.Redact(s)
 	result = strings.ReplaceAll(result, "<", "&lt;")
 	result = strings.ReplaceAll(result, ">", "&gt;")
 	return
 }
 
-func SendMsgToChannel(bot *tgbotapi.BotAPI, channel int64, text string, replyTo int) (err error) {
+func SendMsgToChannel(sender *Sender, channel int64, text string, replyTo int) (err error) {
 	if text == "/where" {
-		return sendWhere(bot, channel, replyTo)
+		return sendWhere(sender, channel, replyTo)
 	}
 
-	text = strings.ReplaceAll(text, "<br />", "\n")
-	text = strings.ReplaceAll(text, "<br/>", "\n")
-	text = strings.ReplaceAll(text, "<br>", "\n")
-	text = strings.ReplaceAll(text, "&nbsp;", " ")
-	text = strings.ReplaceAll(text, "&quot;", `"`)
-	text = strings.ReplaceAll(text, "&amp;", "&")
-	text = strings.ReplaceAll(text, "&bull;", "•")
+	return sendHtml(sender, channel, format.Html(text), replyTo, PriorityHigh)
+}
+
+func sendHtml(sender *Sender, channel int64, text string, replyTo int, prio Priority) (err error) {
+	_, err = sendHtmlMarkup(sender, channel, text, replyTo, prio, nil)
+	return
+}
 
-	if len(text) > 4096 {
-		text = text[:4092]
-		idx := strings.LastIndex(text, "\n")
-		if idx > 0 {
-			text = text[:idx-1] + " ..."
+// sendHtmlMarkup attaches markup to the last part and returns its text
+func sendHtmlMarkup(sender *Sender, channel int64, text string, replyTo int, prio Priority, markup interface{}) (last string, err error) {
+	return sendHtmlParts(sender, channel, text, replyTo, prio, markup, nil)
+}
+
+// sendHtmlParts skips the parts which are sent already and counts sent parts in sent if it is not nil
+func sendHtmlParts(sender *Sender, channel int64, text string, replyTo int, prio Priority, markup interface{}, sent *int) (last string, err error) {
+	parts := format.Split(text, format.MaxLength)
+	start := 0
+	if sent != nil && *sent > 0 {
+		start = *sent
+		replyTo = 0
+	}
+	if start >= len(parts) {
+		if len(parts) > 0 {
+			last = parts[len(parts)-1]
 		}
+		return
 	}
+	for i, part := range parts[start:] {
+		i += start
+		msg := tgbotapi.NewMessage(channel, part)
 
-	msg := tgbotapi.NewMessage(channel, text)
-
-	msg.ParseMode = tgbotapi.ModeHTML
-	msg.DisableWebPagePreview = true
+		msg.ParseMode = tgbotapi.ModeHTML
+		msg.DisableWebPagePreview = true
 
-	if replyTo > 0 {
-		msg.ReplyToMessageID = replyTo
-	}
+		if replyTo > 0 {
+			msg.ReplyToMessageID = replyTo
+			replyTo = 0
+		}
+		if i == len(parts)-1 && markup != nil {
+			msg.ReplyMarkup = markup
+		}
 
-	_, err = bot.Send(msg)
-	if err != nil {
-		appendMsgToLog(text, err.Error())
+		_, err = sender.Send(channel, msg, prio)
+		if err != nil {
+			appendMsgToLog(part, err.Error())
+			return
+		}
+		if sent != nil {
+			*sent = i + 1
+		}
+		last = part
 	}
 	return
 }
@@ -128,30 +156,153 @@ func appendMsgToLog(text string, errText string) {
 	}
 }
 
-func SendMsgToUser(bot *tgbotapi.BotAPI, user string, text string) error {
+func SendMsgToUser(sender *Sender, user string, text string) error {
 	userInfo := model.UserInfo{}
 	err := pudge.Get(model.DBPathUsers, user, &userInfo)
 	if err != nil {
 		return err
 	}
 
-	err = SendMsgToChannel(bot, userInfo.ChannelID, text, 0)
+	err = SendMsgToChannel(sender, userInfo.ChannelID, text, 0)
 	return err
 }
 
-func processMessage(msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
+func SendJobToUser(sender *Sender, user string, job model.Job) error {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, user, &userInfo)
+	if err != nil {
+		return err
+	}
+
+	return TelegramNotifier{Sender: sender, UserInfo: userInfo}.SendJob(job)
+}
+
+func setLayout(userId string, layout string) string {
+	if !format.IsLayout(layout) {
+		return "Unknown layout, use one of: " + strings.Join(format.Layouts, ", ")
+	}
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+	userInfo.Layout = layout
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "Layout is set to <b>" + layout + "</b>"
+}
+
+func setLongMode(userId string, mode string) string {
+	if mode != format.LongSplit && mode != format.LongTruncate {
+		return "Type /long split|truncate"
+	}
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+	userInfo.LongMode = mode
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "Long messages mode is set to <b>" + mode + "</b>"
+}
+
+// startUser activates the user, approved is false if the user has no access
+func startUser(sender *Sender, msg *tgbotapi.Message, userId string, payload string, bt *bot.BotStruct) (reply string, approved bool) {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			userInfo.UserName = msg.From.UserName
+			userInfo.ChannelID = msg.Chat.ID
+			userInfo.Feeds = []model.FeedInfo{}
+
+			access, reply := newUserAccess(sender, userId, msg.From.UserName, payload)
+			switch access {
+			case model.AccessDenied:
+				return reply, false
+			case model.AccessPending:
+				userInfo.Access = access
+				err = pudge.Set(model.DBPathUsers, userId, userInfo)
+				if err != nil {
+					logrus.Panic(err)
+				}
+				return reply, false
+			}
+		}
+	}
+
+	if userInfo.Suspended {
+		return "Your user is suspended by the admin", false
+	}
+	switch userInfo.Access {
+	case model.AccessPending:
+		return "Your user is waiting for approval of the admin", false
+	case model.AccessDenied:
+		return "Access denied", false
+	}
+	if userInfo.Active {
+		return "Your user is active already", true
+	}
+
+	userInfo.Active = true
+	userInfo.Blocked = false
+	userInfo.Pull = config.GetDelay()
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	feedInfo := ""
+	if upwork.HasActiveFeeds(&userInfo) {
+		feedInfo = "You have some channels already, check with /list\n\n"
+		upwork.StartFetch(userId, bt)
+	}
+
+	return "Thank you for subscribing the bot.\n\n" + feedInfo + "Please add feed channels by /add command or /help for help", true
+}
+
+// feedAdded is the reply to /add and /search
+func feedAdded(title string) string {
+	return fmt.Sprintf("<b>%s</b> added succesfully. Default pull interval is 5 minutes. You will receive new jobs from the moment", escapeHtml(title))
+}
+
+func processMessage(sender *Sender, msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
+	if msg.From == nil {
+		return
+	}
 	userId := fmt.Sprintf("%d", msg.From.ID)
 	text := msg.Text
-	// words := strings.Fields(text)
-	// if len(words) == 0 {
-	// 	log.Println("WARN: wrong command")
-	// 	reply = "wrong command"
-	// 	return
-	// }
+	words := strings.Fields(text)
+	cmd := ""
+	if len(words) > 0 {
+		cmd = words[0]
+	}
 
-	// cmd := words[0]
+	cmd, ok, reply := groupCommand(sender, msg, cmd)
+	if !ok {
+		return
+	}
+	if len(words) > 0 && cmd != words[0] {
+		words[0] = cmd
+		text = strings.Join(words, " ")
+	}
 
-	switch text {
+	if denied := accessDenied(userId, cmd); denied != "" {
+		reply = denied
+		return
+	}
+
+	switch cmd {
 	case "/help":
 		reply = `
 /help       - this help
@@ -160,38 +311,54 @@ func processMessage(msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
 /ping       - pong
 /list       - list all your feeds
 /add        - add feed
+/search     - add feed from search: /search golang budget>=500 hourly
 /del				- del feed
+/layout     - job message layout: compact, full or minimal
+/long       - long messages: split into parts or truncate with link
+/sink       - additional destinations: slack, discord, webhook
+/route      - send feed jobs to group or channel: /route 1 @channel
+/ws         - shared team workspaces
+/claimed    - jobs claimed in this chat
+/mine       - jobs claimed by you
+/tpl        - cover letter templates for proposal drafts
+/saved      - saved jobs
+/remind     - remind about saved job: /remind 1 2h
+/find       - search received jobs: /find golang api 7d
+/stats      - jobs statistics of this month
+/tz         - your timezone for /stats: /tz Europe/Berlin
+/trend      - alerts when jobs of feed or keyword are spiking: /trend add rust
+/clients    - followed and bad clients
+/pull       - pull interval: /pull 5m
+`
+		if !isAdmin(userId) {
+			reply += "/plan       - your plan and limits\n"
+		} else {
+			reply += `
+/users      - all users
+/user       - user details: /user ID
+/suspend    - suspend user: /suspend ID [off]
+/broadcast  - message to all active users
+/health     - queues, feed errors and db size
+/reload     - reload config
+/pending    - users waiting for approval: /approve ID, /deny ID
+/invite     - invite link: /invite [USES]
+/plan       - your plan and limits, set user plan: /plan ID free|pro|team [DAYS]
+/dead       - undelivered jobs
 `
-	case "/start":
-		userInfo := model.UserInfo{}
-		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
-		if err != nil {
-			if errors.Is(err, pudge.ErrKeyNotFound) {
-				userInfo.UserName = msg.From.UserName
-				userInfo.ChannelID = msg.Chat.ID
-				userInfo.Feeds = []model.FeedInfo{}
-			}
-		}
-
-		if userInfo.Active {
-			reply = "Your user is active already"
-			return
 		}
-
-		userInfo.Active = true
-		userInfo.Pull = config.GetDelay()
-		err = pudge.Set(model.DBPathUsers, userId, userInfo)
-		if err != nil {
-			logrus.Panic(err)
+	case "/start":
+		payload := ""
+		if len(words) == 2 {
+			payload = words[1]
 		}
-		feedInfo := ""
-		if upwork.HasActiveFeeds(&userInfo) {
-			feedInfo = "You have some channels already, check with /list\n\n"
-			bt.Wg.Add(1)
-			go upwork.FetchUser(userInfo.UserName, bt)
+		var approved bool
+		reply, approved = startUser(sender, msg, userId, payload, bt)
+		// deep-link payload of workspace invite, only for users who have access
+		if approved && len(words) == 2 {
+			if joined := joinWorkspace(userId, words[1]); joined != "" {
+				reply = joined + "\n\n" + reply
+			}
 		}
-
-		reply = "Thank you for subscribing the bot.\n\n" + feedInfo + "Please add feed channels by /add command or /help for help"
 	case "/stop":
 		setActive(userId, false)
 	case "/ping":
@@ -211,16 +378,54 @@ func processMessage(msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
 			reply = "Type /start to resume"
 			return
 		}
+		if reply = feedLimit(userInfo); reply != "" {
+			return
+		}
 		userInfo.WaitingFeedUrl = model.WaitingAdd
 		err = pudge.Set(model.DBPathUsers, userId, userInfo)
 		if err != nil {
 			logrus.Panic(err)
 		}
 		reply = `To help find rss on upwork: /where.<br/>
+		or subscribe to search: /search golang budget>=500 hourly<br/>
 		or paste rss URL to add here:`
 	case "/where":
 		reply = "/where"
 		return
+	case "/search":
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				reply = "Type /start first"
+				return
+			} else {
+				logrus.Panic(err)
+			}
+		}
+		if !userInfo.Active {
+			reply = "Type /start to resume"
+			return
+		}
+		if reply = feedLimit(userInfo); reply != "" {
+			return
+		}
+		if upwork.HasFilters(words[1:]) && !plan.Of(userInfo).Filters {
+			reply = "Budget, job type and category filters are not available on your plan, check /plan"
+			return
+		}
+		url, err := upwork.BuildSearchUrl(words[1:])
+		if err != nil {
+			reply = escapeHtml(err.Error())
+			return
+		}
+		title, err := upwork.AddChannel(userId, url, bt)
+		if err != nil {
+			reply = escapeHtml(err.Error())
+			return
+		}
+
+		reply = feedAdded(title)
 	case "/del":
 		userInfo := model.UserInfo{}
 		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
@@ -254,24 +459,101 @@ func processMessage(msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
 			if !v.IsActive {
 				continue
 			}
-			reply += fmt.Sprintf(`%d) <a href="%s">%s</a><br/>`, i+1, v.Url, v.Title)
+			url, err := secret.Decrypt(v.Url)
+			if err != nil {
+				logrus.Error(err)
+			}
+			route := ""
+			if v.ChatID != 0 {
+				route = " → " + escapeHtml(v.ChatTitle)
+			}
+			// the link is the user's own feed, tokens are redacted in logs only
+			reply += fmt.Sprintf(`%d) <a href="%s">%s</a>%s<br/>`, i+1, format.EscapeAttr(url), escapeHtml(v.Title), route)
 			i += 1
 		}
 		if len(userInfo.Feeds) == 0 {
 			reply = "Empty"
 		}
-	case "/pull 1m":
-		userInfo := model.UserInfo{}
-		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
-		if err != nil {
-			logrus.Panic(err)
+	case "/layout":
+		switch len(words) {
+		case 1:
+			reply = "Type /layout " + strings.Join(format.Layouts, "|")
+		case 2:
+			reply = setLayout(userId, words[1])
+		case 3:
+			if !isAdmin(userId) {
+				reply = "Admin only"
+				return
+			}
+			reply = setLayout(words[1], words[2])
+		default:
+			reply = "Type /layout " + strings.Join(format.Layouts, "|")
 		}
-		userInfo.Pull = 60 * time.Second
-		err = pudge.Set(model.DBPathUsers, userId, userInfo)
-		if err != nil {
-			logrus.Panic(err)
+	case "/long":
+		if len(words) != 2 {
+			reply = "Type /long split|truncate"
+			return
 		}
-		reply = "ok"
+		reply = setLongMode(userId, words[1])
+	case "/dead":
+		if !isAdmin(userId) {
+			reply = "Admin only"
+			return
+		}
+		switch text {
+		case "/dead retry":
+			reply = deadRetry(true)
+		case "/dead clear":
+			reply = deadRetry(false)
+		default:
+			reply = deadList()
+		}
+	case "/sink":
+		reply = sinkCommand(userId, words[1:])
+	case "/claimed":
+		reply = claimedList(msg.Chat.ID, "")
+	case "/mine":
+		reply = claimedList(0, userId)
+	case "/saved":
+		reply = savedCommand(sender, msg, userId)
+	case "/remind":
+		reply = remindCommand(userId, words[1:])
+	case "/find":
+		reply = findCommand(userId, words[1:])
+	case "/stats":
+		reply = statsCommand(userId)
+	case "/tz":
+		reply = tzCommand(userId, words[1:])
+	case "/trend":
+		reply = trendCommand(userId, words[1:])
+	case "/clients":
+		reply = clientsCommand(userId, words[1:])
+	case "/pending", "/approve", "/deny", "/invite":
+		if !isAdmin(userId) {
+			reply = adminOnly(msg)
+			return
+		}
+		reply = accessCommand(sender, cmd, words[1:])
+	case "/users", "/user", "/suspend", "/broadcast", "/health", "/reload":
+		if !isAdmin(userId) {
+			reply = adminOnly(msg)
+			return
+		}
+		reply = adminCommand(sender, cmd, text, words[1:], bt)
+	case "/tpl":
+		reply = tplCommand(userId, text)
+	case "/ws":
+		reply = wsCommand(sender, msg, userId, words[1:], bt)
+	case "/route":
+		reply = routeCommand(sender, msg, userId, words[1:])
+	case "/pull":
+		reply = pullCommand(userId, words[1:])
+	case "/plan":
+		if len(words) > 1 && isAdmin(userId) {
+			reply = setPlan(words[1:])
+			return
+		}
+		reply = planInfo(userId)
 	default:
 		userInfo := model.UserInfo{}
 		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
@@ -280,13 +562,16 @@ func processMessage(msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
 		}
 		switch userInfo.WaitingFeedUrl {
 		case model.WaitingAdd:
+			if reply = feedLimit(userInfo); reply != "" {
+				return
+			}
 			title, err := upwork.AddChannel(userId, text, bt)
 			if err != nil {
 				reply = escapeHtml(err.Error())
 				return
 			}
 
-			reply = fmt.Sprintf("<b>%s</b> added succesfully. Default pull interval is 5 minutes. You will receive new jobs from the moment", title)
+			reply = feedAdded(title)
 		case model.WaitingDel:
 			idx, err := strconv.Atoi(text)
 			if err != nil {
@@ -300,6 +585,8 @@ func processMessage(msg *tgbotapi.Message, bt *bot.BotStruct) (reply string) {
 			}
 
 			reply = "feed removed"
+		case model.WaitingDraft:
+			reply = finishDraft(userId, text)
 		default:
 			reply = "Unknown command"
 		}
@@ -311,77 +598,86 @@ func Start(bt *bot.BotStruct) {
 	defer bt.Wg.Done()
 	defer logrus.Warn("Telegram is down")
 
-	bot, err := tgbotapi.NewBotAPI(config.GetConfig().Telegram.Token)
+	bot, err := newBotAPI()
 	if err != nil {
 		logrus.Panic(err)
 	}
 
 	bot.Debug = false
 
+	// sender outlives bt.Ctx to deliver the last admin message
+	sendCtx, stopSender := context.WithCancel(context.Background())
+	defer stopSender()
+	sender := NewSender(bot)
+	go sender.Run(sendCtx)
+
 	defer func() {
-		SendMsgToUser(bot, config.GetAdmin(), AdminMessage+"bot is going down")
+		SendMsgToUser(sender, config.GetAdmin(), AdminMessage+"bot is going down")
 	}()
 
 	logrus.WithField("bot", bot.Self.UserName).Info("Authorized on account")
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates, err := bot.GetUpdatesChan(u)
+	workers := &sync.WaitGroup{}
+	updates, err := startUpdates(bt, bot, workers)
 	if err != nil {
 		logrus.Panic(err)
 	}
 
-	err = SendMsgToUser(bot, config.GetAdmin(), AdminMessage+"bot is up")
+	err = SendMsgToUser(sender, config.GetAdmin(), AdminMessage+"bot is up")
 	if err != nil {
 		logrus.Warn(err)
 	}
 
+	q := newQueues()
+	workers.Add(1 + len(q.commands) + len(q.deliveries))
+	go receiveUpdates(bt, updates, q, workers)
+	for _, c := range q.commands {
+		go commandWorker(sender, bt, c, workers)
+	}
+	for _, d := range q.deliveries {
+		go deliveryWorker(sender, bt, q, d, workers)
+	}
+	workers.Add(1)
+	go chatWorker(sender, bt, q, workers)
+
+	outboxTicker := time.NewTicker(OutboxTick)
+	defer outboxTicker.Stop()
+	metricsTicker := time.NewTicker(MetricsTick)
+	defer metricsTicker.Stop()
+	alertTicker := time.NewTicker(AlertSummary)
+	defer alertTicker.Stop()
+	alerts := newAlerter(func(text string) {
+		err := SendMsgToUser(sender, config.GetAdmin(), AdminMessage+secret.Redact(text))
+		if err != nil {
+			logrus.Panic(err)
+		}
+	})
+
 	for {
 		select {
-		case update := <-updates:
-			if update.Message == nil { // ignore any non-Message Updates
-				continue
-			}
-
-			logrus.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
-
-			reply := processMessage(update.Message, bt)
-			err := SendMsgToChannel(bot, update.Message.Chat.ID, reply, update.Message.MessageID)
-			if err != nil {
-				logrus.Errorf("cannot send to chat_id = %d: %T: %s", update.Message.Chat.ID, err, err)
-			}
 		case up := <-bt.Up2tel:
 			logrus.WithField("key", up.Key).Debug("recv")
 
-			err := SendMsgToUser(bot, up.Key.User, up.RSS.Content)
+			q.dispatch(bt, enqueue(up))
+		case <-outboxTicker.C:
+			processReminders(bt, q)
+			processOutbox(bt, q)
+		case <-metricsTicker.C:
+			q.logMetrics(bt)
+		case n := <-bt.Notice:
+			err := SendMsgToUser(sender, n.User, n.Text)
 			if err != nil {
-				var tgErr tgbotapi.Error
-				if errors.As(err, &tgErr) {
-					if tgErr.Message == "Forbidden: bot was blocked by the user" {
-						logrus.Error(tgErr)
-						setActive(up.Key.User, false)
-					}
-				} else {
-					logrus.Errorf("cannot send to user = %s: %T: %s", up.Key.User, err, err)
-				}
-				continue
-			}
-
-			logrus.WithField("key", up.Key).Debug("saving")
-			pubVal := model.JobValue{Published: *up.RSS.PublishedParsed, Processed: time.Now()}
-			err = pudge.Set(model.DBPathJobs, up.Key.Key(), pubVal)
-			if err != nil {
-				logrus.Panic(err)
-			}
-		case msg := <-bt.Admin:
-			err := SendMsgToUser(bot, config.GetAdmin(), AdminMessage+msg)
-			if err != nil {
-				logrus.Panic(err)
+				logrus.WithField("user", n.User).Warn(err)
 			}
+		case alert := <-bt.Admin:
+			alerts.add(alert)
+		case <-alertTicker.C:
+			alerts.summary()
 		case <-bt.Ctx.Done():
 			logrus.Debug("telegram: done")
-			err := SendMsgToUser(bot, config.GetAdmin(), AdminMessage+"bot is going down")
+			workers.Wait()
+			q.logMetrics(bt)
+			err := SendMsgToUser(sender, config.GetAdmin(), AdminMessage+"bot is going down")
 			if err != nil {
 				logrus.Panic(err)
 			}
@@ -488,6 +784,62 @@ func MigrateOneUser() {
 // 	}
 // }
 
+// EncryptUrls encrypts feed and sink urls stored before the storage key was configured
+func EncryptUrls() {
+	encrypt := func(url *string) bool {
+		stored, err := secret.Encrypt(*url)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		changed := stored != *url
+		*url = stored
+		return changed
+	}
+
+	keys, err := pudge.Keys(model.DBPathUsers, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	for _, key := range keys {
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, key, &userInfo)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		changed := 0
+		for i := range userInfo.Feeds {
+			if encrypt(&userInfo.Feeds[i].Url) {
+				changed++
+			}
+		}
+		for i := range userInfo.Sinks {
+			if encrypt(&userInfo.Sinks[i].Url) {
+				changed++
+			}
+		}
+		if changed == 0 {
+			continue
+		}
+		err = pudge.Set(model.DBPathUsers, key, userInfo)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		logrus.WithField("user", string(key)).WithField("urls", changed).Info("encrypted")
+	}
+
+	for _, ws := range allWorkspaces() {
+		_, err := upwork.UpdateWorkspace(ws.ID, func(ws *model.Workspace) error {
+			for i := range ws.Feeds {
+				encrypt(&ws.Feeds[i].Url)
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.Panic(err)
+		}
+	}
+}
+
 func Cleanup() {
 	db, err := pudge.Open(model.DBPathJobs, &pudge.Config{})
 	if err != nil {
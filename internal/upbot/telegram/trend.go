@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const trendUsage = "Type /trend add WORD, /trend del WORD or /trend to list. Feeds are watched always"
+
+// trendCommand manages keywords watched for volume spikes
+func trendCommand(userId string, args []string) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	switch {
+	case len(args) == 0:
+		if len(userInfo.Keywords) == 0 {
+			return "No keywords.<br/>" + trendUsage
+		}
+		return "Watched keywords: " + escapeHtml(strings.Join(userInfo.Keywords, ", "))
+	case len(args) == 2 && (args[0] == "add" || args[0] == "del"):
+		terms := upwork.Terms(args[1])
+		if len(terms) != 1 || terms[0] != strings.ToLower(args[1]) {
+			return "one word expected"
+		}
+		kw := terms[0]
+		if args[0] == "add" {
+			if contains(userInfo.Keywords, kw) {
+				return "ok"
+			}
+			userInfo.Keywords = append(userInfo.Keywords, kw)
+		} else {
+			keywords := []string{}
+			for _, v := range userInfo.Keywords {
+				if v != kw {
+					keywords = append(keywords, v)
+				}
+			}
+			userInfo.Keywords = keywords
+		}
+	default:
+		return trendUsage
+	}
+
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return "ok"
+}
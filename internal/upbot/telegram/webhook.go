@@ -0,0 +1,225 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SecretHeader    = "X-Telegram-Bot-Api-Secret-Token"
+	DefaultListen   = ":8443"
+	DefaultHookPath = "/telegram"
+	maxUpdateSize   = 1 << 20
+	PollTimeout     = 60
+	PollRetry       = 3 * time.Second
+	allowedUpdates  = `["message","callback_query","my_chat_member"]`
+)
+
+// webhookListen is replaced by tests
+var webhookListen = net.Listen
+
+// apiTransport redirects telegram api requests to the configured url
+type apiTransport struct {
+	base *url.URL
+}
+
+func (t apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.base.Scheme
+	req.URL.Host = t.base.Host
+	req.URL.Path = strings.TrimSuffix(t.base.Path, "/") + req.URL.Path
+	req.Host = t.base.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newBotAPI() (*tgbotapi.BotAPI, error) {
+	cfg := config.GetConfig().Telegram
+	if cfg.ApiUrl == "" {
+		return tgbotapi.NewBotAPI(cfg.Token)
+	}
+	base, err := url.Parse(cfg.ApiUrl)
+	if err != nil {
+		return nil, err
+	}
+	return tgbotapi.NewBotAPIWithClient(cfg.Token, &http.Client{Transport: apiTransport{base: base}})
+}
+
+func webhookHandler(bt *bot.BotStruct, secret string, ch chan<- update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(SecretHeader)), []byte(secret)) != 1 {
+			logrus.WithField("remote", r.RemoteAddr).Warn("webhook: wrong secret token")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		up := update{}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&up)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case ch <- up:
+		case <-bt.Ctx.Done():
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// startWebhook registers webhook in telegram and serves updates until bt.Ctx is done
+func startWebhook(bt *bot.BotStruct, api *tgbotapi.BotAPI, wg *sync.WaitGroup) (<-chan update, error) {
+	cfg := config.GetConfig().Telegram.Webhook
+	// the endpoint is public, anybody could send updates on behalf of any user without the secret
+	if cfg.Secret == "" {
+		return nil, errors.New("webhook secret is required")
+	}
+	listen := cfg.Listen
+	if listen == "" {
+		listen = DefaultListen
+	}
+	path := cfg.Path
+	if path == "" {
+		path = DefaultHookPath
+	}
+
+	ch := make(chan update, api.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler(bt, cfg.Secret, ch))
+	server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	// certificate and listen errors are returned here, before the webhook is registered
+	if cfg.Cert != "" && cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	l, err := webhookListen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("url", cfg.Url)
+	params.Set("allowed_updates", allowedUpdates)
+	params.Set("secret_token", cfg.Secret)
+	_, err = api.MakeRequest("setWebhook", params)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(l, "", "")
+		} else {
+			err = server.Serve(l)
+		}
+		// the bot does not get updates anymore, it is stopped and the webhook is deleted
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Error("webhook: ", err)
+			bt.Cancel()
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		<-bt.Ctx.Done()
+
+		_, err := api.MakeRequest("deleteWebhook", url.Values{})
+		if err != nil {
+			logrus.Error(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = server.Shutdown(ctx)
+		if err != nil {
+			logrus.Error(err)
+		}
+		logrus.Info("webhook is down")
+	}()
+
+	logrus.WithField("listen", l.Addr().String()).WithField("path", path).Info("webhook is up")
+	return ch, nil
+}
+
+// startUpdates returns updates from webhook if configured, or from long polling
+func startUpdates(bt *bot.BotStruct, api *tgbotapi.BotAPI, wg *sync.WaitGroup) (<-chan update, error) {
+	if config.GetConfig().Telegram.Webhook.Url != "" {
+		return startWebhook(bt, api, wg)
+	}
+
+	// getUpdates does not work while webhook is set
+	_, err := api.MakeRequest("deleteWebhook", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan update, api.Buffer)
+	go pollUpdates(bt, api, ch)
+	return ch, nil
+}
+
+// pollUpdates is long polling of getUpdates, tgbotapi drops my_chat_member updates
+func pollUpdates(bt *bot.BotStruct, api *tgbotapi.BotAPI, ch chan<- update) {
+	offset := 0
+	for {
+		params := url.Values{}
+		params.Set("offset", strconv.Itoa(offset))
+		params.Set("timeout", strconv.Itoa(PollTimeout))
+		params.Set("allowed_updates", allowedUpdates)
+
+		resp, err := api.MakeRequest("getUpdates", params)
+		updates := []update{}
+		if err == nil {
+			err = json.Unmarshal(resp.Result, &updates)
+		}
+		if err != nil {
+			logrus.Warn("getUpdates: ", err)
+			select {
+			case <-time.After(PollRetry):
+				continue
+			case <-bt.Ctx.Done():
+				return
+			}
+		}
+
+		for _, up := range updates {
+			if up.UpdateID >= offset {
+				offset = up.UpdateID + 1
+			}
+			select {
+			case ch <- up:
+			case <-bt.Ctx.Done():
+				return
+			}
+		}
+		if bt.Ctx.Err() != nil {
+			return
+		}
+	}
+}
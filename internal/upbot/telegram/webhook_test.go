@@ -0,0 +1,297 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/config"
+)
+
+// fakeTelegram answers bot api methods by handlers and records requests
+type fakeTelegram struct {
+	mu       sync.Mutex
+	calls    map[string][]url.Values
+	handlers map[string]func(params url.Values) string
+}
+
+func newFakeTelegram(t *testing.T) (*fakeTelegram, *httptest.Server) {
+	f := &fakeTelegram{calls: map[string][]url.Values{}, handlers: map[string]func(url.Values) string{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		r.ParseForm()
+		f.mu.Lock()
+		f.calls[method] = append(f.calls[method], r.PostForm)
+		handler := f.handlers[method]
+		f.mu.Unlock()
+
+		result := "true"
+		switch {
+		case handler != nil:
+			result = handler(r.PostForm)
+		case method == "getMe":
+			result = `{"id":1,"is_bot":true,"first_name":"bot","username":"test_bot"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeTelegram) called(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values{}, f.calls[method]...)
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func setTelegram(apiUrl string, webhook config.Webhook) {
+	cfg := config.Config{}
+	cfg.Telegram.Token = "T"
+	cfg.Telegram.ApiUrl = apiUrl
+	cfg.Telegram.Webhook = webhook
+	config.Set(cfg)
+}
+
+func newTestBot() (*bot.BotStruct, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &bot.BotStruct{Wg: &sync.WaitGroup{}, Ctx: ctx, Cancel: cancel, Metrics: &bot.Metrics{}}, cancel
+}
+
+const chatMemberUpdate = `{"update_id":7,"my_chat_member":{"chat":{"id":5,"type":"private"},"from":{"id":5},"date":1,` +
+	`"old_chat_member":{"status":"member"},"new_chat_member":{"status":"kicked"}}}`
+
+func receiveUpdate(t *testing.T, ch <-chan update) update {
+	select {
+	case up := <-ch:
+		return up
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update")
+	}
+	return update{}
+}
+
+func TestWebhook(t *testing.T) {
+	fake, srv := newFakeTelegram(t)
+	listen := freeAddr(t)
+	setTelegram(srv.URL, config.Webhook{Url: "https://example.com/hook", Listen: listen, Secret: "s3cret"})
+
+	api, err := newBotAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, cancel := newTestBot()
+	defer cancel()
+	wg := &sync.WaitGroup{}
+	updates, err := startUpdates(bt, api, wg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := fake.called("setWebhook")
+	if len(set) != 1 || set[0].Get("url") != "https://example.com/hook" ||
+		set[0].Get("secret_token") != "s3cret" || set[0].Get("allowed_updates") != allowedUpdates {
+		t.Fatalf("unexpected setWebhook: %v", set)
+	}
+
+	post := func(secret string) int {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+listen+DefaultHookPath, strings.NewReader(chatMemberUpdate))
+		if secret != "" {
+			req.Header.Set(SecretHeader, secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, secret := range []string{"", "wrong"} {
+		if code := post(secret); code != http.StatusForbidden {
+			t.Errorf("secret %q: expected 403, got %d", secret, code)
+		}
+	}
+	if code := post("s3cret"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	up := receiveUpdate(t, updates)
+	if up.MyChatMember == nil || up.MyChatMember.NewChatMember.Status != "kicked" || updateUser(up) != 5 {
+		t.Errorf("unexpected update: %+v", up)
+	}
+
+	cancel()
+	wg.Wait()
+	if len(fake.called("deleteWebhook")) != 1 {
+		t.Error("webhook is not deleted on shutdown")
+	}
+}
+
+func TestWebhookRequiresSecret(t *testing.T) {
+	fake, srv := newFakeTelegram(t)
+	setTelegram(srv.URL, config.Webhook{Url: "https://example.com/hook", Listen: freeAddr(t)})
+
+	api, err := newBotAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, cancel := newTestBot()
+	defer cancel()
+	_, err = startUpdates(bt, api, &sync.WaitGroup{})
+	if err == nil {
+		t.Fatal("webhook without secret must not start")
+	}
+	if len(fake.called("setWebhook")) != 0 {
+		t.Error("webhook must not be registered")
+	}
+}
+
+func TestWebhookListenError(t *testing.T) {
+	_, srv := newFakeTelegram(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	setTelegram(srv.URL, config.Webhook{Url: "https://example.com/hook", Listen: l.Addr().String(), Secret: "s"})
+
+	api, err := newBotAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, cancel := newTestBot()
+	defer cancel()
+	_, err = startUpdates(bt, api, &sync.WaitGroup{})
+	if err == nil {
+		t.Fatal("busy address must be returned as error")
+	}
+}
+
+func TestWebhookBadCert(t *testing.T) {
+	fake, srv := newFakeTelegram(t)
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(cert, []byte("not a cert"), 0600)
+	os.WriteFile(key, []byte("not a key"), 0600)
+	setTelegram(srv.URL, config.Webhook{Url: "https://example.com/hook", Listen: freeAddr(t), Secret: "s", Cert: cert, Key: key})
+
+	api, err := newBotAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, cancel := newTestBot()
+	defer cancel()
+	_, err = startUpdates(bt, api, &sync.WaitGroup{})
+	if err == nil {
+		t.Fatal("bad certificate must be returned as error")
+	}
+	if len(fake.called("setWebhook")) != 0 {
+		t.Error("webhook must not be registered")
+	}
+}
+
+func TestWebhookServeError(t *testing.T) {
+	fake, srv := newFakeTelegram(t)
+	setTelegram(srv.URL, config.Webhook{Url: "https://example.com/hook", Listen: freeAddr(t), Secret: "s"})
+	var l net.Listener
+	webhookListen = func(network, addr string) (net.Listener, error) {
+		var err error
+		l, err = net.Listen(network, addr)
+		return l, err
+	}
+	defer func() { webhookListen = net.Listen }()
+
+	api, err := newBotAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, cancel := newTestBot()
+	defer cancel()
+	wg := &sync.WaitGroup{}
+	_, err = startUpdates(bt, api, wg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the listener fails under the running server
+	l.Close()
+
+	select {
+	case <-bt.Ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot is not stopped")
+	}
+	wg.Wait()
+	if len(fake.called("deleteWebhook")) != 1 {
+		t.Error("webhook is not deleted")
+	}
+}
+
+func TestPollUpdates(t *testing.T) {
+	fake, srv := newFakeTelegram(t)
+	fake.handlers["getUpdates"] = func(params url.Values) string {
+		if params.Get("offset") == "0" {
+			return `[{"update_id":6,"message":{"message_id":1,"from":{"id":5},"chat":{"id":5,"type":"private"},"date":1,"text":"/list"}},` +
+				chatMemberUpdate + `]`
+		}
+		time.Sleep(10 * time.Millisecond)
+		return `[]`
+	}
+	setTelegram(srv.URL, config.Webhook{})
+
+	api, err := newBotAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, cancel := newTestBot()
+	defer cancel()
+	updates, err := startUpdates(bt, api, &sync.WaitGroup{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.called("deleteWebhook")) != 1 {
+		t.Error("webhook must be deleted before polling")
+	}
+
+	if up := receiveUpdate(t, updates); up.Message == nil || up.Message.Text != "/list" {
+		t.Errorf("unexpected update: %+v", up)
+	}
+	if up := receiveUpdate(t, updates); up.MyChatMember == nil {
+		t.Errorf("unexpected update: %+v", up)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		calls := fake.called("getUpdates")
+		last := calls[len(calls)-1]
+		if last.Get("offset") == "8" {
+			if last.Get("allowed_updates") != allowedUpdates {
+				t.Errorf("unexpected allowed_updates: %s", last.Get("allowed_updates"))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			b, _ := json.Marshal(calls)
+			t.Fatalf("offset is not confirmed: %s", b)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,204 @@
+package telegram
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	CommandWorkers  = 4
+	DeliveryWorkers = 8
+	WorkerQueueLen  = 20
+	MetricsTick     = 5 * time.Minute
+)
+
+// queues shard work by user, so commands and jobs of the same user are processed in order
+type queues struct {
+	commands   []chan update
+	deliveries []chan model.OutboxItem
+
+	// inflight are outbox keys which wait in delivery queues or are being delivered
+	mu       sync.Mutex
+	inflight map[string]bool
+}
+
+func newQueues() *queues {
+	q := &queues{inflight: map[string]bool{}}
+	for i := 0; i < CommandWorkers; i++ {
+		q.commands = append(q.commands, make(chan update, WorkerQueueLen))
+	}
+	for i := 0; i < DeliveryWorkers; i++ {
+		q.deliveries = append(q.deliveries, make(chan model.OutboxItem, WorkerQueueLen))
+	}
+	return q
+}
+
+func shard(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// dispatch never blocks: if the delivery queue is busy the job waits in the outbox.
+// The job which is in flight already is not dispatched again
+func (q *queues) dispatch(bt *bot.BotStruct, item model.OutboxItem) bool {
+	key := item.Job.OutboxKey()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inflight[key] {
+		return false
+	}
+	select {
+	case q.deliveries[shard(item.Job.Key.User, len(q.deliveries))] <- item:
+		q.inflight[key] = true
+		return true
+	default:
+		bt.Metrics.Skipped.Add(1)
+		return false
+	}
+}
+
+func (q *queues) isInflight(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.inflight[key]
+}
+
+func (q *queues) done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, key)
+}
+
+func (q *queues) logMetrics(bt *bot.BotStruct) {
+	commands, deliveries := 0, 0
+	for _, c := range q.commands {
+		commands += len(c)
+	}
+	for _, d := range q.deliveries {
+		deliveries += len(d)
+	}
+	logrus.WithFields(logrus.Fields{
+		"up2tel":    len(bt.Up2tel),
+		"admin":     len(bt.Admin),
+		"commandsQ": commands,
+		"deliveryQ": deliveries,
+		"commands":  bt.Metrics.Commands.Load(),
+		"delivered": bt.Metrics.Delivered.Load(),
+		"retried":   bt.Metrics.Retried.Load(),
+		"failed":    bt.Metrics.Failed.Load(),
+		"skipped":   bt.Metrics.Skipped.Load(),
+	}).Info("metrics")
+}
+
+// updateUser returns id of the user who sent the update, 0 for updates the bot does not handle
+func updateUser(up update) int64 {
+	switch {
+	case up.Message != nil && up.Message.From != nil:
+		return int64(up.Message.From.ID)
+	case up.CallbackQuery != nil:
+		return int64(up.CallbackQuery.From.ID)
+	case up.MyChatMember != nil:
+		return int64(up.MyChatMember.From.ID)
+	}
+	return 0
+}
+
+func receiveUpdates(bt *bot.BotStruct, updates <-chan update, q *queues, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case update := <-updates:
+			user := updateUser(update)
+			if user == 0 { // ignore other updates
+				continue
+			}
+			select {
+			case q.commands[shard(strconv.FormatInt(user, 10), len(q.commands))] <- update:
+			case <-bt.Ctx.Done():
+				return
+			}
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
+
+// runAs runs the task in the command worker of the user, after the user's commands which are queued already
+func (q *queues) runAs(bt *bot.BotStruct, userId string, task func()) bool {
+	select {
+	case q.commands[shard(userId, len(q.commands))] <- update{task: task}:
+		return true
+	case <-bt.Ctx.Done():
+		return false
+	}
+}
+
+func commandWorker(sender *Sender, bt *bot.BotStruct, updates <-chan update, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case update := <-updates:
+			if update.task != nil {
+				update.task()
+				continue
+			}
+			bt.Metrics.Commands.Add(1)
+			if update.CallbackQuery != nil {
+				processCallback(sender, update.CallbackQuery)
+				continue
+			}
+			if update.MyChatMember != nil {
+				processChatMember(update.MyChatMember, bt)
+				continue
+			}
+
+			msg := update.Message
+			if msg.MigrateToChatID != 0 {
+				changes.add(chatChange{From: msg.Chat.ID, To: msg.MigrateToChatID, Title: chatTitle(*msg.Chat)})
+				continue
+			}
+			logrus.Printf("[%s] %s", msg.From.UserName, msg.Text)
+
+			reply := processMessage(sender, msg, bt)
+			if reply == "" {
+				continue
+			}
+			err := SendMsgToChannel(sender, msg.Chat.ID, reply, msg.MessageID)
+			if err != nil {
+				logrus.Errorf("cannot send to chat_id = %d: %T: %s", msg.Chat.ID, err, err)
+			}
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
+
+func deliveryWorker(sender *Sender, bt *bot.BotStruct, q *queues, items <-chan model.OutboxItem, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case item := <-items:
+			switch deliver(sender, item) {
+			case Delivered:
+				bt.Metrics.Delivered.Add(1)
+			case Retry:
+				bt.Metrics.Retried.Add(1)
+			case Failed:
+				bt.Metrics.Failed.Add(1)
+			}
+			q.done(item.Job.OutboxKey())
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/upwork"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const invitePrefix = "ws"
+
+const wsUsage = `/ws                 - current workspace
+/ws new NAME        - create workspace
+/ws use NAME        - switch current workspace
+/ws invite [editor|viewer] - invite link
+/ws members         - list members
+/ws role ID ROLE    - change member role
+/ws kick ID         - remove member
+/ws leave           - leave workspace
+/ws add URL         - add feed
+/ws del N           - delete feed
+/ws chat here|@channel|off - shared chat for jobs`
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		logrus.Panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func getWorkspace(wsId string) (model.Workspace, error) {
+	ws := model.Workspace{}
+	err := pudge.Get(model.DBPathWorkspaces, wsId, &ws)
+	return ws, err
+}
+
+func setWorkspace(ws model.Workspace) {
+	err := pudge.Set(model.DBPathWorkspaces, ws.ID, ws)
+	if err != nil {
+		logrus.Panic(err)
+	}
+}
+
+func allWorkspaces() (result []model.Workspace) {
+	keys, err := pudge.Keys(model.DBPathWorkspaces, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	for _, key := range keys {
+		ws, err := getWorkspace(string(key))
+		if err != nil {
+			logrus.Panic(err)
+		}
+		result = append(result, ws)
+	}
+	return
+}
+
+func userWorkspaces(userId string) (result []model.Workspace) {
+	for _, ws := range allWorkspaces() {
+		if _, ok := ws.Members[userId]; ok {
+			result = append(result, ws)
+		}
+	}
+	return
+}
+
+func setCurrentWorkspace(userId string, wsId string) {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	userInfo.Workspace = wsId
+	err = pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+}
+
+var (
+	errInviteExpired = errors.New("invite link is expired")
+	errOwnerOnly     = errors.New("owner only")
+)
+
+// ownerOnly checks the role in the record which is going to be changed
+func ownerOnly(ws *model.Workspace, userId string) error {
+	if ws.Members[userId] != model.RoleOwner {
+		return errOwnerOnly
+	}
+	return nil
+}
+
+// joinWorkspace accepts /start payload of the invite link
+func joinWorkspace(userId string, code string) string {
+	if !strings.HasPrefix(code, invitePrefix) {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(code, invitePrefix), "_", 2)
+	if len(parts) != 2 {
+		return "Incorrect invite link"
+	}
+	ws, err := upwork.UpdateWorkspace(parts[0], func(ws *model.Workspace) error {
+		role, ok := ws.Invites[code]
+		if !ok {
+			return errInviteExpired
+		}
+		// the invite is used once
+		delete(ws.Invites, code)
+		if _, member := ws.Members[userId]; !member {
+			ws.Members[userId] = role
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, pudge.ErrKeyNotFound):
+		return "Workspace is not found"
+	case errors.Is(err, errInviteExpired):
+		return "Invite link is expired"
+	case err != nil:
+		logrus.Panic(err)
+	}
+	setCurrentWorkspace(userId, ws.ID)
+
+	return fmt.Sprintf("You joined workspace <b>%s</b> as %s", escapeHtml(ws.Name), ws.Members[userId])
+}
+
+func workspaceInfo(userId string, current string) string {
+	list := userWorkspaces(userId)
+	if len(list) == 0 {
+		return "No workspaces.<br/>" + wsUsage
+	}
+
+	reply := ""
+	for _, ws := range list {
+		mark := ""
+		if ws.ID == current {
+			mark = " (current)"
+		}
+		reply += fmt.Sprintf("<b>%s</b>%s: %s, %d members<br/>", escapeHtml(ws.Name), mark, ws.Members[userId], len(ws.Members))
+		if ws.ID != current {
+			continue
+		}
+		for i, feed := range ws.Feeds {
+			reply += fmt.Sprintf("  %d) %s<br/>", i+1, escapeHtml(feed.Title))
+		}
+		if ws.ChatID != 0 {
+			reply += "  jobs go to " + escapeHtml(ws.ChatTitle) + "<br/>"
+		} else {
+			reply += "  jobs go to every member<br/>"
+		}
+	}
+	return reply
+}
+
+func wsCommand(sender *Sender, msg *tgbotapi.Message, userId string, args []string, bt *bot.BotStruct) string {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "Type /start first"
+		}
+		logrus.Panic(err)
+	}
+
+	if len(args) == 0 {
+		return workspaceInfo(userId, userInfo.Workspace)
+	}
+
+	if args[0] == "new" {
+		if len(args) < 2 {
+			return wsUsage
+		}
+		ws := model.Workspace{
+			ID:      randomHex(4),
+			Name:    strings.Join(args[1:], " "),
+			Members: map[string]model.Role{userId: model.RoleOwner},
+			Invites: map[string]model.Role{},
+		}
+		setWorkspace(ws)
+		setCurrentWorkspace(userId, ws.ID)
+		return fmt.Sprintf("Workspace <b>%s</b> is created, /ws invite to add members", escapeHtml(ws.Name))
+	}
+
+	if args[0] == "use" {
+		if len(args) < 2 {
+			return wsUsage
+		}
+		name := strings.Join(args[1:], " ")
+		for _, ws := range userWorkspaces(userId) {
+			if ws.Name == name || ws.ID == name {
+				setCurrentWorkspace(userId, ws.ID)
+				return fmt.Sprintf("Current workspace is <b>%s</b>", escapeHtml(ws.Name))
+			}
+		}
+		return "Workspace is not found"
+	}
+
+	ws, err := getWorkspace(userInfo.Workspace)
+	if err != nil {
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			return "No current workspace, /ws new NAME or /ws use NAME"
+		}
+		logrus.Panic(err)
+	}
+	role, ok := ws.Members[userId]
+	if !ok {
+		return "You are not a member of the workspace"
+	}
+
+	switch args[0] {
+	case "invite":
+		if role != model.RoleOwner {
+			return "Owner only"
+		}
+		inviteRole := model.RoleViewer
+		if len(args) == 2 {
+			inviteRole = model.Role(args[1])
+		}
+		if inviteRole != model.RoleEditor && inviteRole != model.RoleViewer {
+			return wsUsage
+		}
+		code := invitePrefix + ws.ID + "_" + randomHex(6)
+		_, err := upwork.UpdateWorkspace(ws.ID, func(ws *model.Workspace) error {
+			if err := ownerOnly(ws, userId); err != nil {
+				return err
+			}
+			ws.Invites[code] = inviteRole
+			return nil
+		})
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		return fmt.Sprintf("One-time invite link for %s:<br/>https://t.me/%s?start=%s", inviteRole, sender.Bot.Self.UserName, code)
+	case "members":
+		ids := make([]string, 0, len(ws.Members))
+		for id := range ws.Members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		reply := ""
+		for _, id := range ids {
+			member := model.UserInfo{}
+			err := pudge.Get(model.DBPathUsers, id, &member)
+			if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+				logrus.Panic(err)
+			}
+			reply += fmt.Sprintf("%s @%s %s<br/>", id, escapeHtml(member.UserName), ws.Members[id])
+		}
+		return reply
+	case "role", "kick":
+		if role != model.RoleOwner {
+			return "Owner only"
+		}
+		if len(args) < 2 || args[1] == userId {
+			return wsUsage
+		}
+		newRole := model.Role("")
+		if args[0] == "role" {
+			if len(args) != 3 {
+				return wsUsage
+			}
+			newRole = model.Role(args[2])
+			if newRole != model.RoleOwner && newRole != model.RoleEditor && newRole != model.RoleViewer {
+				return wsUsage
+			}
+		}
+		_, err := upwork.UpdateWorkspace(ws.ID, func(ws *model.Workspace) error {
+			if err := ownerOnly(ws, userId); err != nil {
+				return err
+			}
+			if _, ok := ws.Members[args[1]]; !ok {
+				return errors.New("member is not found")
+			}
+			if newRole == "" {
+				delete(ws.Members, args[1])
+			} else {
+				ws.Members[args[1]] = newRole
+			}
+			return nil
+		})
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		return "ok"
+	case "leave":
+		// the last member deletes the workspace
+		_, err := upwork.UpdateWorkspace(ws.ID, func(ws *model.Workspace) error {
+			owners := 0
+			for _, r := range ws.Members {
+				if r == model.RoleOwner {
+					owners++
+				}
+			}
+			if ws.Members[userId] == model.RoleOwner && owners == 1 && len(ws.Members) > 1 {
+				return errors.New("pass owner role to another member first")
+			}
+			delete(ws.Members, userId)
+			return nil
+		})
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		setCurrentWorkspace(userId, "")
+		return "You left the workspace"
+	case "add":
+		if !role.CanEdit() {
+			return "Owner or editor only"
+		}
+		if len(args) != 2 {
+			return wsUsage
+		}
+		if limit := wsFeedLimit(ws); limit != "" {
+			return limit
+		}
+		title, err := upwork.AddWorkspaceFeed(ws.ID, args[1], bt)
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		return fmt.Sprintf("<b>%s</b> added to workspace", escapeHtml(title))
+	case "del":
+		if !role.CanEdit() {
+			return "Owner or editor only"
+		}
+		if len(args) != 2 {
+			return wsUsage
+		}
+		idx, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "number expected"
+		}
+		err = upwork.DelWorkspaceFeed(ws.ID, idx-1)
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		return "feed removed"
+	case "chat":
+		if !role.CanEdit() {
+			return "Owner or editor only"
+		}
+		if len(args) != 2 {
+			return wsUsage
+		}
+		chatId, title := int64(0), ""
+		if args[1] != "off" {
+			chat, err := resolveChat(sender, args[1], msg.Chat, msg.From.ID)
+			if err != nil {
+				return escapeHtml(err.Error())
+			}
+			chatId, title = chat.ID, chatTitle(chat)
+		}
+		_, err := upwork.UpdateWorkspace(ws.ID, func(ws *model.Workspace) error {
+			ws.ChatID = chatId
+			ws.ChatTitle = title
+			return nil
+		})
+		if err != nil {
+			return escapeHtml(err.Error())
+		}
+		return "ok"
+	}
+	return wsUsage
+}
+
+// sendWorkspaceJob sends to the shared chat, or to every member which has not got the job yet
+func sendWorkspaceJob(sender *Sender, wsKey string, job model.Job, done []string, parts map[string]int) ([]string, error) {
+	ws, err := getWorkspace(strings.TrimPrefix(wsKey, model.WorkspacePrefix))
+	if err != nil {
+		return done, err
+	}
+
+	if ws.ChatID != 0 {
+		n := TelegramNotifier{Sender: sender, Chat: ws.ChatID}
+		err := sendResumable(n, TelegramSinkID, job, parts)
+		if err != nil {
+			return done, err
+		}
+		return append(done, TelegramSinkID), nil
+	}
+
+	var firstErr error
+	for id := range ws.Members {
+		sinkId := "member:" + id
+		if contains(done, sinkId) {
+			continue
+		}
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, id, &userInfo)
+		if err != nil {
+			logrus.WithField("user", id).Warn(err)
+			continue
+		}
+		if !userInfo.Active {
+			continue
+		}
+		n := TelegramNotifier{Sender: sender, UserInfo: userInfo}
+		err = sendResumable(n, sinkId, job, parts)
+		if err != nil {
+			logrus.WithField("workspace", ws.ID).WithField("user", id).Warn(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		done = append(done, sinkId)
+	}
+	return done, firstErr
+}
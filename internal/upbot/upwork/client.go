@@ -0,0 +1,124 @@
+package upwork
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+// spentTier rounds spend down to the order of magnitude
+func spentTier(v float64) string {
+	if v < 1000 {
+		return "<$1K"
+	}
+	tier := math.Pow(10, math.Floor(math.Log10(v)))
+	if tier >= 1e6 {
+		return fmt.Sprintf("$%gM+", tier/1e6)
+	}
+	return fmt.Sprintf("$%gK+", tier/1e3)
+}
+
+// jobsTier rounds number of posted jobs down to the order of magnitude
+func jobsTier(n int) string {
+	tier := 1
+	for tier*10 <= n {
+		tier *= 10
+	}
+	return fmt.Sprintf("%d+ jobs", tier)
+}
+
+// ClientFingerprint identifies client by signals which do not change: country and member since.
+// Verification, spend, jobs and rating grow while the client hires, they are shown in the label only.
+// Empty if the feed has no member since, country alone matches too many clients
+func ClientFingerprint(job model.Job) (id string, label string) {
+	if job.ClientSince == "" {
+		return "", ""
+	}
+	parts := []string{job.Country, "since " + job.ClientSince}
+	sum := sha1.Sum([]byte(strings.Join(parts, ", ")))
+
+	if job.Country == "" {
+		parts = parts[1:]
+	}
+	if job.ClientVerified {
+		parts = append(parts, "verified")
+	}
+	if job.ClientSpent > 0 {
+		parts = append(parts, spentTier(job.ClientSpent)+" spent")
+	}
+	if job.ClientJobs > 0 {
+		parts = append(parts, jobsTier(job.ClientJobs))
+	}
+	if job.ClientRating > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f★", job.ClientRating))
+	}
+	return hex.EncodeToString(sum[:6]), strings.Join(parts, ", ")
+}
+
+func Followers(clientId string) []string {
+	users := []string{}
+	err := pudge.Get(model.DBPathClients, clientId, &users)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+	return users
+}
+
+// followersMu serializes read-modify-write of the followers lists
+var followersMu sync.Mutex
+
+// SetFollower adds or removes the user from followers of the client
+func SetFollower(clientId string, userId string, follow bool) {
+	followersMu.Lock()
+	defer followersMu.Unlock()
+
+	users := []string{}
+	for _, u := range Followers(clientId) {
+		if u != userId {
+			users = append(users, u)
+		}
+	}
+	if follow {
+		users = append(users, userId)
+	}
+
+	var err error
+	if len(users) == 0 {
+		err = pudge.Delete(model.DBPathClients, clientId)
+		if errors.Is(err, pudge.ErrKeyNotFound) {
+			err = nil
+		}
+	} else {
+		err = pudge.Set(model.DBPathClients, clientId, users)
+	}
+	if err != nil {
+		logrus.Panic(err)
+	}
+}
+
+// notifyFollowers tells users following the client about the new job from any feed
+func notifyFollowers(job model.Job, bt *bot.BotStruct) {
+	clientId, label := ClientFingerprint(job)
+	if clientId == "" {
+		return
+	}
+	for _, userId := range Followers(clientId) {
+		text := fmt.Sprintf(`👀 New job from followed client (%s): <a href="%s">%s</a>`,
+			format.EscapeHtml(label), format.EscapeAttr(job.Link), format.EscapeHtml(job.Title))
+		select {
+		case bt.Notice <- bot.Notice{User: userId, Text: text}:
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
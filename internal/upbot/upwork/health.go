@@ -0,0 +1,72 @@
+package upwork
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthExpire drops feeds which are not fetched anymore: deleted, stopped or of stopped users
+const HealthExpire = 24 * time.Hour
+
+// FeedHealth is fetch statistics of the feed since start
+type FeedHealth struct {
+	User    string
+	Feed    string
+	Fetches int
+	Errors  int
+	LastErr string
+	LastAt  time.Time
+}
+
+var (
+	healthMu sync.Mutex
+	health   = map[string]*FeedHealth{}
+)
+
+func recordFetch(userId string, title string, err error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	key := userId + ";" + title
+	h := health[key]
+	if h == nil {
+		pruneHealth()
+		h = &FeedHealth{User: userId, Feed: title}
+		health[key] = h
+	}
+	h.Fetches++
+	h.LastAt = time.Now()
+	if err != nil {
+		h.Errors++
+		h.LastErr = err.Error()
+	}
+}
+
+// pruneHealth drops expired feeds, healthMu is held by the caller
+func pruneHealth() {
+	for key, h := range health {
+		if time.Since(h.LastAt) > HealthExpire {
+			delete(health, key)
+		}
+	}
+}
+
+// Health returns feeds fetched during HealthExpire ordered by errors
+func Health() []FeedHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	pruneHealth()
+	result := make([]FeedHealth, 0, len(health))
+	for _, h := range health {
+		result = append(result, *h)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Errors != result[j].Errors {
+			return result[i].Errors > result[j].Errors
+		}
+		return result[i].User+result[i].Feed < result[j].User+result[j].Feed
+	})
+	return result
+}
@@ -0,0 +1,220 @@
+package upwork
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/mmcdole/gofeed"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	MinTermLength = 2
+	// SearchDays is how long jobs are kept in the content and in the full-text index, a month for /stats
+	SearchDays    = 31
+	PruneInterval = 24 * time.Hour
+
+	indexDate = "20060102"
+)
+
+// indexMu serializes the check and store of the job content
+var indexMu sync.Mutex
+
+// stopWords are too common to search by, they would make the longest term lists
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`about after all also am an and any are as at be been but by can could do does
+		for from has have he her his how if in into is it its just me more my need needs no not of on one or our out
+		so some than that the their them then there these they this to up us very was we well were what when which
+		who will with would you your
+		budget category click country hourly posted range skills apply upwork utc`) {
+		stopWords[w] = true
+	}
+}
+
+// Terms splits text into unique lowercase words for the full-text index, stop words are skipped
+func Terms(text string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	})
+	for _, w := range words {
+		if len([]rune(w)) < MinTermLength || seen[w] || stopWords[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+func jobTerms(job model.Job) []string {
+	return Terms(job.Title + " " + html.UnescapeString(format.Text(job.Description)) + " " + strings.Join(job.Skills, " "))
+}
+
+func searchSince() time.Time {
+	return time.Now().AddDate(0, 0, -SearchDays)
+}
+
+// indexKey is term;date;jobId, one key for every term of the job, so the term is not rewritten by new jobs
+func indexKey(term string, added time.Time, jobId string) string {
+	return term + ";" + added.UTC().Format(indexDate) + ";" + jobId
+}
+
+// parseIndexKey returns date and job id of the key, ok is false for keys of other format
+func parseIndexKey(key string) (date string, jobId string, ok bool) {
+	parts := strings.Split(key, ";")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// SaveContent stores the job once for all users and adds it to the full-text index,
+// returns false if the job is stored already
+func SaveContent(item gofeed.Item) bool {
+	// the same job can be fetched by several users at once
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	jobId := model.JobID(item.GUID)
+	has, err := pudge.Has(model.DBPathContent, jobId)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	if has {
+		return false
+	}
+
+	now := time.Now()
+	job := ParseJob(&item)
+	err = pudge.Set(model.DBPathContent, jobId, model.JobContent{Job: job, RSS: item, Stored: now})
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	for _, term := range jobTerms(job) {
+		err = pudge.Set(model.DBPathIndex, indexKey(term, now, jobId), []byte{})
+		if err != nil {
+			logrus.Panic(err)
+		}
+	}
+	return true
+}
+
+func LoadContent(jobId string) (content model.JobContent, err error) {
+	err = pudge.Get(model.DBPathContent, jobId, &content)
+	return
+}
+
+// termJobs returns ids of jobs containing the term which are added since the date
+func termJobs(term string, since string) map[string]bool {
+	keys, err := pudge.Keys(model.DBPathIndex, term+";*", 0, 0, true)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+	ids := map[string]bool{}
+	for _, key := range keys {
+		date, jobId, ok := parseIndexKey(string(key))
+		if ok && date >= since {
+			ids[jobId] = true
+		}
+	}
+	return ids
+}
+
+// Find returns ids of jobs of the last SearchDays containing all terms
+func Find(terms []string) []string {
+	since := searchSince().UTC().Format(indexDate)
+	var result []string
+	for i, term := range terms {
+		ids := termJobs(term, since)
+		if len(ids) == 0 {
+			return nil
+		}
+		if i == 0 {
+			for id := range ids {
+				result = append(result, id)
+			}
+			continue
+		}
+		filtered := []string{}
+		for _, id := range result {
+			if ids[id] {
+				filtered = append(filtered, id)
+			}
+		}
+		result = filtered
+	}
+	return result
+}
+
+// pruneContent deletes jobs and index keys older than SearchDays, and index keys of old format
+func pruneContent() {
+	since := searchSince()
+	sinceDate := since.UTC().Format(indexDate)
+
+	keys, err := pudge.Keys(model.DBPathIndex, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	pruned := 0
+	for _, key := range keys {
+		date, _, ok := parseIndexKey(string(key))
+		if ok && date >= sinceDate {
+			continue
+		}
+		err := pudge.Delete(model.DBPathIndex, key)
+		if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+			logrus.Panic(err)
+		}
+		pruned++
+	}
+	logrus.WithField("keys", pruned).Info("index is pruned")
+
+	keys, err = pudge.Keys(model.DBPathContent, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	pruned = 0
+	for _, key := range keys {
+		content := model.JobContent{}
+		err := pudge.Get(model.DBPathContent, key, &content)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		if content.Stored.After(since) {
+			continue
+		}
+		err = pudge.Delete(model.DBPathContent, key)
+		if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+			logrus.Panic(err)
+		}
+		pruned++
+	}
+	logrus.WithField("jobs", pruned).Info("content is pruned")
+}
+
+// PruneContent prunes the content at start and every PruneInterval
+func PruneContent(bt *bot.BotStruct) {
+	defer bt.Wg.Done()
+
+	for {
+		pruneContent()
+		select {
+		case <-time.After(PruneInterval):
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
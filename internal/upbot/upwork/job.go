@@ -0,0 +1,136 @@
+package upwork
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/mmcdole/gofeed"
+)
+
+const ItemTitleSuffix = " - Upwork"
+
+var (
+	fieldRe  = regexp.MustCompile(`(?s)<b>([^<]+)</b>:\s*(.*?)\s*(?:<br\s*/?>|$)`)
+	amountRe = regexp.MustCompile(`\$([0-9][0-9,]*(?:\.[0-9]+)?)`)
+	applyRe  = regexp.MustCompile(`<a href="([^"]+)">click to apply</a>`)
+	trailRe  = regexp.MustCompile(`(?:\s|<br\s*/?>)+$`)
+	ratingRe = regexp.MustCompile(`[0-9]+(?:\.[0-9]+)?`)
+	spentRe  = regexp.MustCompile(`(?i)\$?([0-9][0-9,]*(?:\.[0-9]+)?)\s*([km]?)`)
+)
+
+// parseSpent parses client spend like "$12.5K+"
+func parseSpent(s string) float64 {
+	m := spentRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(m[2]) {
+	case "k":
+		v *= 1e3
+	case "m":
+		v *= 1e6
+	}
+	return v
+}
+
+func parseAmounts(s string) (result []float64) {
+	for _, m := range amountRe.FindAllStringSubmatch(s, -1) {
+		v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+		if err == nil {
+			result = append(result, v)
+		}
+	}
+	return
+}
+
+// ParseJob extracts budget, rate, skills, etc from upwork rss item content
+func ParseJob(item *gofeed.Item) model.Job {
+	job := model.Job{
+		GUID:  item.GUID,
+		Title: html.UnescapeString(strings.TrimSuffix(item.Title, ItemTitleSuffix)),
+		Link:  item.Link,
+	}
+	if item.PublishedParsed != nil {
+		job.Published = *item.PublishedParsed
+	} else {
+		job.Published = time.Now()
+	}
+
+	content := item.Content
+	if content == "" {
+		content = item.Description
+	}
+
+	descEnd := len(content)
+	for _, m := range fieldRe.FindAllStringSubmatchIndex(content, -1) {
+		if m[0] < descEnd {
+			descEnd = m[0]
+		}
+		name := strings.TrimSpace(content[m[2]:m[3]])
+		value := html.UnescapeString(strings.TrimSpace(content[m[4]:m[5]]))
+		switch name {
+		case "Budget":
+			if amounts := parseAmounts(value); len(amounts) > 0 {
+				job.Budget = amounts[0]
+			}
+		case "Hourly Range":
+			amounts := parseAmounts(value)
+			if len(amounts) > 0 {
+				job.HourlyMin = amounts[0]
+				job.HourlyMax = amounts[len(amounts)-1]
+			}
+		case "Category":
+			job.Category = value
+		case "Skills":
+			for _, skill := range strings.Split(value, ",") {
+				if skill = strings.TrimSpace(skill); skill != "" {
+					job.Skills = append(job.Skills, skill)
+				}
+			}
+		case "Country":
+			job.Country = value
+		case "Client Spent", "Total Spent", "Client Spend":
+			job.ClientSpent = parseSpent(value)
+		case "Client Rating", "Rating":
+			if v, err := strconv.ParseFloat(ratingRe.FindString(value), 64); err == nil {
+				job.ClientRating = v
+			}
+		case "Payment Verified", "Payment Method":
+			lower := strings.ToLower(value)
+			job.ClientVerified = (lower == "yes" || strings.Contains(lower, "verified")) &&
+				!strings.Contains(lower, "unverified") && !strings.Contains(lower, "not")
+		case "Jobs Posted":
+			if v, err := strconv.Atoi(ratingRe.FindString(strings.ReplaceAll(value, ",", ""))); err == nil {
+				job.ClientJobs = v
+			}
+		case "Member Since":
+			job.ClientSince = value
+		}
+	}
+	job.Description = trailRe.ReplaceAllString(content[:descEnd], "")
+
+	if m := applyRe.FindStringSubmatch(content); m != nil && job.Link == "" {
+		job.Link = m[1]
+	}
+
+	return job
+}
+
+var jobIdRe = regexp.MustCompile(`(?i)(?:~|%7E)([0-9a-f]+)`)
+
+// ApplyLink returns proposal page of the job, or the job link if id is not found
+func ApplyLink(link string) string {
+	m := jobIdRe.FindStringSubmatch(link)
+	if m == nil {
+		return link
+	}
+	return "https://www.upwork.com/ab/proposals/job/~" + m[1] + "/apply/"
+}
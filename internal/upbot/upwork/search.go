@@ -0,0 +1,66 @@
+package upwork
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const SearchUrl = "https://www.upwork.com/ab/feed/jobs/rss"
+
+// BuildSearchUrl converts /search arguments into upwork rss search url:
+// keywords [budget>=X] [hourly|fixed] [category=uid]
+func BuildSearchUrl(args []string) (string, error) {
+	q := url.Values{}
+	keywords := []string{}
+
+	for _, arg := range args {
+		lower := strings.ToLower(arg)
+		switch {
+		case strings.HasPrefix(lower, "budget>="):
+			budget, err := strconv.Atoi(strings.TrimPrefix(lower, "budget>="))
+			if err != nil || budget <= 0 {
+				return "", errors.New("budget must be a positive number: budget>=500")
+			}
+			q.Set("budget", strconv.Itoa(budget)+"-")
+		case lower == "hourly" || lower == "fixed":
+			q.Set("job_type", lower)
+		case strings.HasPrefix(lower, "category="):
+			// the prefix is matched in any case, the value keeps its case
+			category := arg[len("category="):]
+			if category == "" {
+				return "", errors.New("empty category")
+			}
+			if _, err := strconv.ParseUint(category, 10, 64); err == nil {
+				q.Set("category2_uid", category)
+			} else {
+				q.Set("subcategory2", category)
+			}
+		default:
+			keywords = append(keywords, arg)
+		}
+	}
+
+	if len(keywords) == 0 {
+		return "", errors.New("keywords expected: /search golang budget>=500 hourly")
+	}
+
+	q.Set("q", strings.Join(keywords, " "))
+	q.Set("sort", "recency")
+	q.Set("paging", "0;10")
+	q.Set("api_params", "1")
+
+	return SearchUrl + "?" + q.Encode(), nil
+}
+
+// HasFilters is true if /search arguments have budget, job type or category filters
+func HasFilters(args []string) bool {
+	for _, arg := range args {
+		lower := strings.ToLower(arg)
+		if strings.HasPrefix(lower, "budget>=") || lower == "hourly" || lower == "fixed" || strings.HasPrefix(lower, "category=") {
+			return true
+		}
+	}
+	return false
+}
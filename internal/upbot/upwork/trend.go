@@ -0,0 +1,125 @@
+package upwork
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/format"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/mmcdole/gofeed"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TrendFactor   = 3.0
+	TrendMinJobs  = 5
+	TrendWindow   = 7 * 24 // hours of the baseline
+	TrendCooldown = 6 * time.Hour
+)
+
+func hourBucket(t time.Time) int64 {
+	return t.Unix() / 3600
+}
+
+// countTrend adds n jobs to the current hour of the counter and drops buckets older than the baseline
+func countTrend(key string, n int, now time.Time) model.Trend {
+	trend := model.Trend{}
+	err := pudge.Get(model.DBPathTrends, key, &trend)
+	if err != nil && !errors.Is(err, pudge.ErrKeyNotFound) {
+		logrus.Panic(err)
+	}
+	if trend.Buckets == nil {
+		trend.Buckets = map[int64]int{}
+		trend.Started = now
+	}
+
+	current := hourBucket(now)
+	trend.Buckets[current] += n
+	for bucket := range trend.Buckets {
+		if bucket < current-TrendWindow {
+			delete(trend.Buckets, bucket)
+		}
+	}
+
+	err = pudge.Set(model.DBPathTrends, key, trend)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return trend
+}
+
+// spike compares the last hour with the average hour of the baseline,
+// counters younger than a day have no baseline yet
+func spike(trend model.Trend, now time.Time) (int, float64, bool) {
+	if now.Sub(trend.Started) < 24*time.Hour || now.Sub(trend.Alerted) < TrendCooldown {
+		return 0, 0, false
+	}
+	current := hourBucket(now)
+	hours := int(now.Sub(trend.Started).Hours())
+	if hours > TrendWindow {
+		hours = TrendWindow
+	}
+	total := 0
+	for bucket, n := range trend.Buckets {
+		if bucket < current {
+			total += n
+		}
+	}
+	last := trend.Buckets[current]
+	avg := float64(total) / float64(hours)
+	if last < TrendMinJobs || float64(last) < TrendFactor*avg {
+		return 0, 0, false
+	}
+	return last, avg, true
+}
+
+// detectTrends counts new jobs of the feed and of user's keywords, and notifies the user about spikes
+func detectTrends(userId string, fd model.FeedInfo, items []*gofeed.Item, bt *bot.BotStruct) {
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	now := time.Now()
+	counts := map[string]int{"feed:" + fd.Title: len(items)}
+	names := map[string]string{"feed:" + fd.Title: fd.Title}
+	for _, kw := range userInfo.Keywords {
+		counts["kw:"+kw] = 0
+		names["kw:"+kw] = kw
+	}
+	for _, item := range items {
+		if len(userInfo.Keywords) == 0 {
+			break
+		}
+		for _, term := range jobTerms(ParseJob(item)) {
+			if _, ok := names["kw:"+term]; ok {
+				counts["kw:"+term]++
+			}
+		}
+	}
+
+	for key, n := range counts {
+		trend := countTrend(userId+";"+key, n, now)
+		last, avg, ok := spike(trend, now)
+		if !ok {
+			continue
+		}
+		trend.Alerted = now
+		err := pudge.Set(model.DBPathTrends, userId+";"+key, trend)
+		if err != nil {
+			logrus.Panic(err)
+		}
+
+		text := fmt.Sprintf("📈 <b>%s</b> jobs are spiking: %d in the last hour, %.1f per hour in average",
+			format.EscapeHtml(names[key]), last, avg)
+		select {
+		case bt.Notice <- bot.Notice{User: userId, Text: text}:
+		case <-bt.Ctx.Done():
+			return
+		}
+	}
+}
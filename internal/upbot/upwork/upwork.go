@@ -3,13 +3,17 @@ package upwork
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/inv2004/goupbot/internal/upbot/bot"
 	"github.com/inv2004/goupbot/internal/upbot/config"
 	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
 	"github.com/mmcdole/gofeed"
 	"github.com/recoilme/pudge"
 	"github.com/sirupsen/logrus"
@@ -18,12 +22,7 @@ import (
 const TitleSuffix = " | upwork.com"
 
 func HasActiveFeeds(userInfo *model.UserInfo) bool {
-	for _, v := range userInfo.Feeds {
-		if v.IsActive {
-			return true
-		}
-	}
-	return false
+	return hasActive(userInfo.Feeds)
 }
 
 func repeatURLRequest(bt *bot.BotStruct, fp *gofeed.Parser, url string, times int) (result *gofeed.Feed, err error) {
@@ -48,11 +47,28 @@ func repeatURLRequest(bt *bot.BotStruct, fp *gofeed.Parser, url string, times in
 	return result, err
 }
 
+// hasJob checks if job is processed already, waits for delivery or failed to deliver
+func hasJob(key model.JobInfoKey) (bool, error) {
+	for _, path := range []string{model.DBPathJobs, model.DBPathOutbox, model.DBPathDead} {
+		has, err := pudge.Has(path, key.Key())
+		if err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
 func FetchRss(userId string, fd model.FeedInfo, dryRun bool, bt *bot.BotStruct) (string, error) {
 	logrus.WithField("user", userId).Info("fetching for: " + fd.Title)
 
+	url, err := secret.Decrypt(fd.Url)
+	if err != nil {
+		return "", err
+	}
+
 	fp := gofeed.NewParser()
-	feed, err := repeatURLRequest(bt, fp, fd.Url, 3)
+	feed, err := repeatURLRequest(bt, fp, url, 3)
+	recordFetch(userId, fd.Title, err)
 	if err != nil {
 		return "", err
 	}
@@ -63,22 +79,34 @@ func FetchRss(userId string, fd model.FeedInfo, dryRun bool, bt *bot.BotStruct)
 	logrus.WithField("user", userId).Debug("Title: ", title)
 
 	newCounter := 0
+	newItems := []*gofeed.Item{}
 
 	for _, item := range feed.Items {
 		key := model.JobInfoKey{User: userId, GUID: item.GUID}
 
-		hasKey, err := pudge.Has(model.DBPathJobs, key.Key())
+		hasKey, err := hasJob(key)
 		if err != nil {
 			logrus.Panic(err)
 		}
 		if !hasKey {
 			newCounter += 1
 			if !dryRun {
+				if SaveContent(*item) {
+					notifyFollowers(ParseJob(item), bt)
+				}
+				newItems = append(newItems, item)
 				job := model.JobInfo{}
 				job.Key = key
 				job.RSS = *item
+				job.Chat = fd.ChatID
+				job.Feed = fd.Title
 				logrus.WithField("key", key).Debug("sending job")
-				bt.Up2tel <- job
+				// blocks while telegram delivery queue is full
+				select {
+				case bt.Up2tel <- job:
+				case <-bt.Ctx.Done():
+					return title, bt.Ctx.Err()
+				}
 			} else {
 				pubVal := model.JobValue{Published: *item.PublishedParsed, Processed: time.Time{}}
 				err := pudge.Set(model.DBPathJobs, key.Key(), pubVal)
@@ -95,9 +123,68 @@ func FetchRss(userId string, fd model.FeedInfo, dryRun bool, bt *bot.BotStruct)
 		logrus.WithField("counter", newCounter).Info("New")
 	}
 
+	if !dryRun && !IsWorkspaceKey(userId) {
+		detectTrends(userId, fd, newItems, bt)
+	}
+
 	return title, nil
 }
 
+var (
+	fetchMu  sync.Mutex
+	fetching = map[string]bool{}
+)
+
+// StartFetch starts polling of the user's feeds unless it is running already
+func StartFetch(userId string, bt *bot.BotStruct) {
+	fetchMu.Lock()
+	defer fetchMu.Unlock()
+	if fetching[userId] {
+		return
+	}
+	fetching[userId] = true
+	bt.Wg.Add(1)
+	go FetchUser(userId, bt)
+}
+
+// fetchState reads the user, the poller is unregistered under the lock if it has nothing to fetch,
+// so StartFetch of reactivated user cannot see the poller which is going down
+func fetchState(userId string) (model.UserInfo, bool) {
+	fetchMu.Lock()
+	defer fetchMu.Unlock()
+
+	userInfo := model.UserInfo{}
+	err := pudge.Get(model.DBPathUsers, userId, &userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	switch {
+	case !userInfo.Active:
+		logrus.WithField("user", userId).Warn("user is not active")
+	case !HasActiveFeeds(&userInfo):
+		logrus.WithField("user", userId).Warn("no active feeds found for user")
+	default:
+		return userInfo, true
+	}
+	delete(fetching, userId)
+	return userInfo, false
+}
+
+// pullInterval is the pull of the user or default delay, not less than minimal pull of access and plan
+func pullInterval(pull time.Duration, p plan.Plan) time.Duration {
+	if pull == 0 {
+		pull = config.GetDelay()
+	}
+	if min := config.GetMinPull(); pull < min {
+		pull = min
+	}
+	if pull < p.MinPull {
+		pull = p.MinPull
+	}
+	return pull
+}
+
+// FetchUser polls the user's feeds, use StartFetch to run it
 func FetchUser(userId string, bt *bot.BotStruct) {
 	defer bt.Wg.Done()
 	defer logrus.WithField("user", userId).Info("fetchUser is going down")
@@ -105,37 +192,44 @@ func FetchUser(userId string, bt *bot.BotStruct) {
 	logrus.WithField("user", userId).Info("fetchUser is started")
 
 	for {
-		userInfo := model.UserInfo{}
-		err := pudge.Get(model.DBPathUsers, userId, &userInfo)
-		if err != nil {
-			logrus.Panic(err)
-		}
-
-		if !HasActiveFeeds(&userInfo) {
-			logrus.WithField("user", userId).Warn("no active feeds found for user")
+		userInfo, ok := fetchState(userId)
+		if !ok {
 			return
 		}
 
-		pullTimeout := userInfo.Pull
-		if pullTimeout == 0 {
-			pullTimeout = config.GetDelay()
+		if plan.Expired(userInfo) {
+			downgrade(userId, &userInfo, bt)
 		}
+		userPlan := plan.Of(userInfo)
+
+		pullTimeout := pullInterval(userInfo.Pull, userPlan)
 
 		select {
 		case <-time.After(pullTimeout):
-			if !userInfo.Active {
-				logrus.WithField("user", userId).Warn("user is not active")
+			// the user could be stopped or changed while sleeping
+			userInfo, ok = fetchState(userId)
+			if !ok {
 				return
 			}
 
+			fetched := 0
 			for _, v := range userInfo.Feeds {
 				if !v.IsActive {
 					continue
 				}
+				// feeds over the plan quota are kept but not fetched
+				if fetched == userPlan.MaxFeeds {
+					break
+				}
+				fetched++
 				_, err := FetchRss(userId, v, false, bt)
 				if err != nil {
 					logrus.Error(err)
-					bt.Admin <- err.Error()
+					select {
+					case bt.Admin <- bot.Alert{User: userId, Feed: v.Title, Err: err.Error()}:
+					case <-bt.Ctx.Done():
+						return
+					}
 				}
 			}
 		case <-bt.Ctx.Done():
@@ -145,6 +239,24 @@ func FetchUser(userId string, bt *bot.BotStruct) {
 	}
 }
 
+// downgrade moves the user with expired plan to the free plan
+func downgrade(userId string, userInfo *model.UserInfo, bt *bot.BotStruct) {
+	expired := userInfo.Plan
+	userInfo.Plan = plan.Free
+	userInfo.PlanExpires = time.Time{}
+	err := pudge.Set(model.DBPathUsers, userId, userInfo)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	logrus.WithField("user", userId).Info("plan expired: " + expired)
+
+	text := fmt.Sprintf("Your <b>%s</b> plan has expired, you are on the free plan now. Check limits with /plan", expired)
+	select {
+	case bt.Notice <- bot.Notice{User: userId, Text: text}:
+	case <-bt.Ctx.Done():
+	}
+}
+
 func Start(bt *bot.BotStruct) {
 	defer bt.Wg.Done()
 
@@ -154,9 +266,13 @@ func Start(bt *bot.BotStruct) {
 	}
 
 	for _, userId := range keys {
-		bt.Wg.Add(1)
-		go FetchUser(string(userId), bt)
+		StartFetch(string(userId), bt)
 	}
+
+	startWorkspaces(bt)
+
+	bt.Wg.Add(1)
+	go PruneContent(bt)
 }
 
 func AddChannel(userId string, url string, bt *bot.BotStruct) (string, error) {
@@ -170,15 +286,18 @@ func AddChannel(userId string, url string, bt *bot.BotStruct) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	userInfo.Feeds = append(userInfo.Feeds, model.FeedInfo{IsActive: true, Title: title, Url: url})
+	storedUrl, err := secret.Encrypt(url)
+	if err != nil {
+		return "", err
+	}
+	userInfo.Feeds = append(userInfo.Feeds, model.FeedInfo{IsActive: true, Title: title, Url: storedUrl})
 	err = pudge.Set(model.DBPathUsers, userId, userInfo)
 	if err != nil {
 		logrus.Panic(err)
 	}
 
 	if NActiveFeeds(&userInfo) >= 1 {
-		bt.Wg.Add(1)
-		go FetchUser(userId, bt)
+		StartFetch(userId, bt)
 	}
 
 	return title, nil
@@ -209,15 +328,18 @@ func DelChannel(userId string, idx int, bt *bot.BotStruct) error {
 	}
 
 	if NActiveFeeds(&userInfo) == 1 {
-		bt.Wg.Add(1)
-		go FetchUser(userId, bt)
+		StartFetch(userId, bt)
 	}
 
 	return nil
 }
 
 func NActiveFeeds(userInfo *model.UserInfo) (result int) {
-	for _, v := range userInfo.Feeds {
+	return NActive(userInfo.Feeds)
+}
+
+func NActive(feeds []model.FeedInfo) (result int) {
+	for _, v := range feeds {
 		if v.IsActive {
 			result += 1
 		}
@@ -0,0 +1,201 @@
+package upwork
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inv2004/goupbot/internal/upbot/bot"
+	"github.com/inv2004/goupbot/internal/upbot/model"
+	"github.com/inv2004/goupbot/internal/upbot/plan"
+	"github.com/inv2004/goupbot/internal/upbot/secret"
+	"github.com/recoilme/pudge"
+	"github.com/sirupsen/logrus"
+)
+
+func hasActive(feeds []model.FeedInfo) bool {
+	for _, v := range feeds {
+		if v.IsActive {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkspacePlan is the best plan of the workspace owners, quotas of the workspace feeds
+func WorkspacePlan(ws model.Workspace) plan.Plan {
+	best := plan.Plans[plan.Free]
+	for id, role := range ws.Members {
+		if role != model.RoleOwner {
+			continue
+		}
+		userInfo := model.UserInfo{}
+		err := pudge.Get(model.DBPathUsers, id, &userInfo)
+		if err != nil {
+			if errors.Is(err, pudge.ErrKeyNotFound) {
+				continue
+			}
+			logrus.Panic(err)
+		}
+		if p := plan.Of(userInfo); p.MaxFeeds > best.MaxFeeds {
+			best = p
+		}
+	}
+	return best
+}
+
+// StartWorkspaceFetch starts polling of the workspace feeds unless it is running already
+func StartWorkspaceFetch(wsId string, bt *bot.BotStruct) {
+	fetchMu.Lock()
+	defer fetchMu.Unlock()
+	if fetching[model.WorkspacePrefix+wsId] {
+		return
+	}
+	fetching[model.WorkspacePrefix+wsId] = true
+	bt.Wg.Add(1)
+	go FetchWorkspace(wsId, bt)
+}
+
+// workspaceState reads the workspace, the poller is unregistered under the lock if it has nothing to fetch
+func workspaceState(wsId string) (model.Workspace, bool) {
+	fetchMu.Lock()
+	defer fetchMu.Unlock()
+
+	ws := model.Workspace{}
+	err := pudge.Get(model.DBPathWorkspaces, wsId, &ws)
+	switch {
+	case errors.Is(err, pudge.ErrKeyNotFound):
+	case err != nil:
+		logrus.Panic(err)
+	case !hasActive(ws.Feeds):
+		logrus.WithField("workspace", wsId).Warn("no active feeds found for workspace")
+	default:
+		return ws, true
+	}
+	delete(fetching, model.WorkspacePrefix+wsId)
+	return ws, false
+}
+
+// FetchWorkspace polls workspace feeds, jobs are stored under ws:ID key, use StartWorkspaceFetch to run it
+func FetchWorkspace(wsId string, bt *bot.BotStruct) {
+	defer bt.Wg.Done()
+	defer logrus.WithField("workspace", wsId).Info("fetchWorkspace is going down")
+
+	logrus.WithField("workspace", wsId).Info("fetchWorkspace is started")
+
+	for {
+		ws, ok := workspaceState(wsId)
+		if !ok {
+			return
+		}
+		wsPlan := WorkspacePlan(ws)
+
+		select {
+		case <-time.After(pullInterval(0, wsPlan)):
+			// feeds could be changed while sleeping
+			ws, ok = workspaceState(wsId)
+			if !ok {
+				return
+			}
+
+			fetched := 0
+			for _, v := range ws.Feeds {
+				if !v.IsActive {
+					continue
+				}
+				// feeds over the plan quota are kept but not fetched
+				if fetched == wsPlan.MaxFeeds {
+					break
+				}
+				fetched++
+				fd := v
+				fd.ChatID = ws.ChatID
+				_, err := FetchRss(ws.Key(), fd, false, bt)
+				if err != nil {
+					logrus.Error(err)
+					select {
+					case bt.Admin <- bot.Alert{User: ws.Key(), Feed: v.Title, Err: err.Error()}:
+					case <-bt.Ctx.Done():
+						return
+					}
+				}
+			}
+		case <-bt.Ctx.Done():
+			logrus.WithField("workspace", wsId).Debug("stop fetch")
+			return
+		}
+	}
+}
+
+func startWorkspaces(bt *bot.BotStruct) {
+	keys, err := pudge.Keys(model.DBPathWorkspaces, nil, 0, 0, true)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	for _, wsId := range keys {
+		StartWorkspaceFetch(string(wsId), bt)
+	}
+}
+
+var workspaceMu sync.Mutex
+
+// UpdateWorkspace changes the workspace under the lock, members change it from different workers.
+// The workspace is deleted if no members are left
+func UpdateWorkspace(wsId string, change func(ws *model.Workspace) error) (model.Workspace, error) {
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+
+	ws := model.Workspace{}
+	err := pudge.Get(model.DBPathWorkspaces, wsId, &ws)
+	if err != nil {
+		return ws, err
+	}
+	err = change(&ws)
+	if err != nil {
+		return ws, err
+	}
+	if len(ws.Members) == 0 {
+		return ws, pudge.Delete(model.DBPathWorkspaces, wsId)
+	}
+	return ws, pudge.Set(model.DBPathWorkspaces, wsId, ws)
+}
+
+// AddWorkspaceFeed drains the feed and adds it to the workspace
+func AddWorkspaceFeed(wsId string, url string, bt *bot.BotStruct) (string, error) {
+	// the feed is fetched before the lock, it is slow
+	title, err := FetchRss(model.WorkspacePrefix+wsId, model.FeedInfo{Title: "", Url: url}, true, bt)
+	if err != nil {
+		return "", err
+	}
+	storedUrl, err := secret.Encrypt(url)
+	if err != nil {
+		return "", err
+	}
+	_, err = UpdateWorkspace(wsId, func(ws *model.Workspace) error {
+		ws.Feeds = append(ws.Feeds, model.FeedInfo{IsActive: true, Title: title, Url: storedUrl})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	StartWorkspaceFetch(wsId, bt)
+	return title, nil
+}
+
+func DelWorkspaceFeed(wsId string, idx int) error {
+	_, err := UpdateWorkspace(wsId, func(ws *model.Workspace) error {
+		if !(0 <= idx && idx < len(ws.Feeds)) {
+			return errors.New("incorrect index to delete")
+		}
+		ws.Feeds = append(ws.Feeds[:idx], ws.Feeds[idx+1:]...)
+		return nil
+	})
+	return err
+}
+
+func IsWorkspaceKey(user string) bool {
+	return strings.HasPrefix(user, model.WorkspacePrefix)
+}